@@ -1,3 +1,5 @@
 module github.com/leochen2038/goplay
 
-go 1.14
\ No newline at end of file
+go 1.14
+
+require gopkg.in/yaml.v2 v2.4.0
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/leochen2038/goplay/reconst/env"
+	"github.com/leochen2038/goplay/reconst/meta"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -81,7 +82,7 @@ func createAssets() (err error) {
 	if err = os.MkdirAll(env.ProjectPath+"/assets/meta", 0744); err != nil {
 		return
 	}
-	return
+	return meta.WriteSchema(false)
 }
 
 func createLibrary() (err error) {
@@ -7,6 +7,7 @@ import (
 	"github.com/leochen2038/goplay/initProject"
 	"github.com/leochen2038/goplay/reconst"
 	"github.com/leochen2038/goplay/reconst/env"
+	"github.com/leochen2038/goplay/reconst/meta"
 	"os"
 	"runtime"
 	"strings"
@@ -22,7 +23,9 @@ func init() {
 
 The commands are:
 	init	init a new project
-	reconst	project path`)
+	reconst	project path
+	meta	convert <src> <dst>, convert meta between xml, yaml and json
+		schema <path>, rewrite assets/meta/meta.xsd with the current definition`)
 		os.Exit(1)
 	}
 
@@ -54,6 +57,22 @@ func main() {
 		if err := reconst.ReconstProject(); err != nil {
 			fmt.Println(err)
 		}
+	case "meta":
+		if len(os.Args) == 4 && os.Args[2] == "schema" {
+			env.ProjectPath = os.Args[3]
+			if err := meta.WriteSchema(true); err != nil {
+				fmt.Println(err)
+			}
+			return
+		}
+		if len(os.Args) < 5 || os.Args[2] != "convert" {
+			fmt.Println("usage: play meta convert <src> <dst>")
+			fmt.Println("       play meta schema <path>")
+			os.Exit(1)
+		}
+		if err := meta.ConvertMeta(os.Args[3], os.Args[4]); err != nil {
+			fmt.Println(err)
+		}
 	default:
 		fmt.Println("unknow command:", command)
 	}
@@ -0,0 +1,142 @@
+package meta
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 可以做Sum/Avg的数值类型，以及Sum结果对应的go类型，decimal的Sum和Avg都是Decimal，不会丢失精度
+var numericSumTypes = map[string]string{
+	"int":     "int64",
+	"int64":   "int64",
+	"uint":    "uint64",
+	"uint8":   "uint64",
+	"uint16":  "uint64",
+	"uint32":  "uint64",
+	"uint64":  "uint64",
+	"float":   "float64",
+	"decimal": "Decimal",
+}
+
+// Avg结果对应的go类型
+func avgGolangType(t string) string {
+	if t == "decimal" {
+		return "Decimal"
+	}
+	return "float64"
+}
+
+// 可以做GroupCount的标量类型，数组、map、bytes、json不参与分组
+func isScalarType(field MetaField) bool {
+	if field.structName != "" {
+		return false
+	}
+	t := getFieldGolangType(field)
+	return !strings.HasPrefix(t, "[]") && !strings.HasPrefix(t, "map[") && t != "interface{}" && t != "JSON"
+}
+
+// 可以做Sum/Avg/Min/Max的字段：数值、时间和日期
+func isAggregateField(field MetaField) bool {
+	_, ok := numericSumTypes[field.Type]
+	return ok || isTimeType(field.Type) || isDateType(field.Type)
+}
+
+// 版本号和软删除标记的合计和平均值没有意义，只生成Min/Max
+func isSumField(field MetaField) bool {
+	_, ok := numericSumTypes[field.Type]
+	return ok && !field.Version && field.Type != "dtime"
+}
+
+// 可以做GroupCount的字段：时间和日期以外的标量
+func isGroupCountField(field MetaField) bool {
+	return isScalarType(field) && !isTimeType(field.Type) && !isDateType(field.Type)
+}
+
+// 有可以聚合的字段且框架提供Aggregate时生成Sum/Avg/Min/Max，store中的Aggregate同样只在这时生成
+func hasAggregate(meta Meta) bool {
+	for _, field := range meta.Fields.List {
+		if isAggregateField(field) {
+			return hasDriveAPI(meta, "Aggregate")
+		}
+	}
+	return false
+}
+
+// 有可以分组的字段且框架提供GroupCount时生成GroupCount<Field>
+func hasGroupCount(meta Meta) bool {
+	for _, field := range meta.Fields.List {
+		if isGroupCountField(field) {
+			return hasDriveAPI(meta, "GroupCount")
+		}
+	}
+	return false
+}
+
+// 数值字段生成Sum/Avg/Min/Max，时间和日期字段只生成Min/Max，其余的标量字段生成GroupCount<Field>分组统计
+func genAggregateCode(meta Meta, funcName string) (code string) {
+	drive := meta.Strategy.Storage.Drive
+	for _, field := range meta.Fields.List {
+		if !hasAggregate(meta) || !isAggregateField(field) {
+			continue
+		}
+		fieldType := getFieldGolangType(field)
+		name := ucfirst(field.Name)
+
+		if sumType := numericSumTypes[field.Type]; isSumField(field) {
+			code += fmt.Sprintf(`
+func (q *query%s)Sum%s() (%s, error) {
+	var val %s
+	if q.check(true) != nil {
+		return val, q.err
+	}
+	err := %s.Aggregate(&val, "sum", "%s", q.scope())
+	return val, err
+}
+
+func (q *query%s)Avg%s() (%s, error) {
+	var val %s
+	if q.check(true) != nil {
+		return val, q.err
+	}
+	err := %s.Aggregate(&val, "avg", "%s", q.scope())
+	return val, err
+}
+`, funcName, name, sumType, sumType, drive, field.Name, funcName, name, avgGolangType(field.Type), avgGolangType(field.Type), drive, field.Name)
+		}
+
+		for _, fn := range []string{"Min", "Max"} {
+			code += fmt.Sprintf(`
+func (q *query%s)%s%s() (%s, error) {
+	var val %s
+	if q.check(true) != nil {
+		return val, q.err
+	}
+	err := %s.Aggregate(&val, "%s", "%s", q.scope())
+	return val, err
+}
+`, funcName, fn, name, fieldType, fieldType, drive, strings.ToLower(fn), field.Name)
+		}
+	}
+
+	if !hasGroupCount(meta) {
+		return
+	}
+	for _, field := range meta.Fields.List {
+		if !isGroupCountField(field) {
+			continue
+		}
+		fieldType := getFieldGolangType(field)
+		code += fmt.Sprintf(`
+// GroupCount%s 按%s分组统计记录数，返回的map以字段的值为键
+func (q *query%s)GroupCount%s() (map[%s]int64, error) {
+	if q.check(true) != nil {
+		return nil, q.err
+	}
+	val := map[%s]int64{}
+	err := %s.GroupCount(&val, "%s", q.scope())
+	return val, err
+}
+`, ucfirst(field.Name), field.Name, funcName, ucfirst(field.Name), fieldType, fieldType, drive, field.Name)
+	}
+	return
+}
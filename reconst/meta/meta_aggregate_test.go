@@ -0,0 +1,71 @@
+package meta
+
+import "testing"
+
+func TestAggregates(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML})
+	assertContains(t, sources, "shop_user.go",
+		"func (q *queryShopUser) SumAge() (int64, error) {",
+		"func (q *queryShopUser) AvgAge() (float64, error) {",
+		"func (q *queryShopUser) MaxAge() (int, error) {",
+		"func (q *queryShopUser) SumBalance() (Decimal, error) {",
+		"func (q *queryShopUser) GroupCountStatus() (map[ShopUserStatus]int64, error) {",
+		"func (q *queryShopUser) GroupCountName() (map[string]int64, error) {",
+		"func (q *queryShopUser) MinCtime() (int64, error) {",
+		"func (q *queryShopUser) MaxVersion() (int, error) {",
+	)
+	// 时间字段只有Min/Max，字符串没有数值聚合，版本号和软删除标记不做合计和平均，数组不分组
+	assertNoDecls(t, sources, "shop_user.go", "queryShopUser.SumCtime", "queryShopUser.SumName", "queryShopUser.AvgName",
+		"queryShopUser.SumVersion", "queryShopUser.AvgVersion", "queryShopUser.SumDtime", "queryShopUser.AvgDtime",
+		"queryShopUser.GroupCountTags", "queryShopUser.GroupCountCtime")
+}
+
+// 已发布的框架没有Aggregate和GroupCount，mysql的meta只使用v0.4.5的接口，可以对照已发布的框架编译
+func TestAggregatesNeedFramework(t *testing.T) {
+	sources := buildProject(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML}, true, nil)
+	assertNoDecls(t, sources, "shop_user.go", "queryShopUser.SumAge", "queryShopUser.GroupCountStatus",
+		"shopUserStoreDriver.Aggregate", "shopUserStoreDriver.GroupCount", "ShopUserMemoryStore.Aggregate", "ShopUserMemoryStore.values")
+}
+
+func TestGroupCountRun(t *testing.T) {
+	const tagXML = `<meta module="shop" name="tag">
+  <key name="id" type="auto"/>
+  <fields>
+    <field name="name" type="string"/>
+    <field name="tags" type="array:string"/>
+  </fields>
+  <strategy>
+    <storage type="mysql" database="shop" table="tag"/>
+  </strategy>
+</meta>
+`
+	sources := buildProject(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML, "tag.xml": tagXML}, false, map[string]string{"group_test.go": `package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupCount(t *testing.T) {
+	defer UseShopUserStore(NewShopUserMemoryStore(
+		MetaShopUser{Id: 1, Status: ShopUserStatusActive, Age: 10},
+		MetaShopUser{Id: 2, Status: ShopUserStatusActive, Age: 20},
+		MetaShopUser{Id: 3, Status: ShopUserStatusBanned, Age: 30},
+	))()
+	counts, err := ShopUser().GroupCountStatus()
+	want := map[ShopUserStatus]int64{ShopUserStatusActive: 2, ShopUserStatusBanned: 1}
+	if err != nil || !reflect.DeepEqual(counts, want) {
+		t.Errorf("GroupCountStatus() = %v, %v, want %v", counts, err, want)
+	}
+	if counts, err := ShopUser().WhereAgeGreater(10).GroupCountAge(); err != nil || !reflect.DeepEqual(counts, map[int]int64{20: 1, 30: 1}) {
+		t.Errorf("GroupCountAge() = %v, %v", counts, err)
+	}
+	if sum, err := ShopUser().SumAge(); err != nil || sum != 60 {
+		t.Errorf("SumAge() = %v, %v", sum, err)
+	}
+}
+`})
+	// 没有可以聚合的字段时不生成Sum/Avg/Min/Max和store中的Aggregate
+	assertNoDecls(t, sources, "shop_tag.go", "shopTagStoreDriver.Aggregate", "ShopTagMemoryStore.Aggregate")
+	assertDecls(t, sources, "shop_tag.go", "queryShopTag.GroupCountName", "ShopTagMemoryStore.GroupCount")
+}
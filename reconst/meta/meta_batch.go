@@ -0,0 +1,202 @@
+package meta
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 按字段常量取meta中对应字段的值，供Upsert等需要动态取值的场景使用
+func genFieldValueCode(meta Meta, funcName string) (code string) {
+	code = fmt.Sprintf("\nfunc (meta *Meta%s)fieldValue(field %sField) interface{} {\n\tswitch field {\n", funcName, funcName)
+	for _, key := range meta.Keys {
+		code += fmt.Sprintf("\tcase %sField%s:\n\t\treturn meta.%s\n", funcName, formatUcfirstName(key.Name), formatUcfirstName(key.Name))
+	}
+	for _, field := range meta.Fields.List {
+		code += fmt.Sprintf("\tcase %sField%s:\n\t\treturn meta.%s\n", funcName, formatUcfirstName(field.Name), ucfirst(field.Name))
+	}
+	code += "\t}\n\treturn nil\n}\n"
+	return
+}
+
+func genBatchCode(meta Meta, funcName string) string {
+	drive, key := meta.Strategy.Storage.Drive, formatUcfirstName(meta.Key.Name)
+	_, versioned := getVersionField(meta)
+	updateManyCode := fmt.Sprintf("return %s.UpdateMany(list, &q.query)", drive)
+	if versioned {
+		updateManyCode = genUpdateManyVersionCode(meta)
+	}
+
+	if meta.Strategy.Storage.Type == "mongodb" {
+		upsertCode := fmt.Sprintf(`filter := bson.M{}
+	for _, field := range conflict {
+		filter[string(field)] = meta.fieldValue(field)
+	}
+	return %s.Upsert(meta, filter, %s, &q.query)`, drive, genInsertOnlyCode(meta))
+		if versioned {
+			upsertCode = genUpsertVersionCode(meta, funcName, fmt.Sprintf("return %s.Save(meta, nil, &q.query)", drive))
+		}
+		saveMany := fmt.Sprintf(`
+// saveMany 通过一次bulkWrite插入多条新记录，没有主键的记录会生成新的ObjectID，已存在的记录需要通过UpdateMany更新
+func (q *query%s)saveMany(list []*Meta%s) error {
+	if q.err != nil {
+		return q.err
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	%s
+	%s
+	for _, meta := range list {
+		%s
+		if meta.%s == primitive.NilObjectID {
+			meta.%s = primitive.NewObjectID()
+		}
+	}
+	return %s.SaveMany(list, &q.query)
+}
+`, funcName, funcName, genValidateCallCode(meta, true, ""), genRouteManyCode(meta, ""), genTouchCode(meta, "meta"), key, key, drive)
+		upsert := fmt.Sprintf(`
+// upsert 以conflict字段(默认为主键)作为过滤条件，存在则更新，不存在则插入，ctime只在插入时写入
+func (q *query%s)upsert(meta *Meta%s, conflict ...%sField) error {
+	if q.err != nil {
+		return q.err
+	}
+	if len(conflict) == 0 {
+		conflict = []%sField{%sField%s}
+	}
+	%s
+	%s
+	%s
+	if meta.%s == primitive.NilObjectID {
+		meta.%s = primitive.NewObjectID()
+	}
+	%s
+}
+`, funcName, funcName, funcName, funcName, funcName, key, genValidateCallCode(meta, false, ""), genRouteMetaCode(meta), genTouchCode(meta, "meta"), key, key, upsertCode)
+		updateMany := fmt.Sprintf(`
+// updateMany 通过一次bulkWrite按主键更新多条记录，有版本号时逐条按版本号更新
+func (q *query%s)updateMany(list []*Meta%s) (int64, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+	if len(list) == 0 {
+		return 0, nil
+	}
+	%s
+	%s
+	%s
+	%s
+}
+`, funcName, funcName, genValidateCallCode(meta, true, "0, "), genRouteManyCode(meta, "0, "), genUpdateManyTouchCode(meta), updateManyCode)
+		return genBatchMethods(meta, saveMany, upsert, updateMany)
+	}
+
+	saveManyCode := fmt.Sprintf("_, err := %s.SaveMany(list, &q.query)\n\treturn err", drive)
+	fields := "fields := make([]string, 0, len(conflict))\n\tfor _, field := range conflict {\n\t\tfields = append(fields, string(field))\n\t}\n\t"
+	upsertCode := fields + fmt.Sprintf("_, err := %s.Upsert(meta, fields, %s, &q.query)\n\treturn err", drive, genInsertOnlyCode(meta))
+	insertCode := fmt.Sprintf("_, err = %s.Save(meta, &q.query)\n\treturn err", drive)
+	if isAutoIncrementKey(meta) {
+		insertCode = fmt.Sprintf("id, err := %s.Save(meta, &q.query)\n\tif id > 0 {\n\t\tmeta.%s = %s(id)\n\t}\n\treturn err", drive, key, getKeyGolangType(meta))
+		saveManyCode = fmt.Sprintf(`ids, err := %s.SaveMany(list, &q.query)
+	for i, id := range ids {
+		if id > 0 {
+			list[i].%s = %s(id)
+		}
+	}
+	return err`, drive, key, getKeyGolangType(meta))
+		upsertCode = fields + fmt.Sprintf(`id, err := %s.Upsert(meta, fields, %s, &q.query)
+	if id > 0 {
+		meta.%s = %s(id)
+	}
+	return err`, drive, genInsertOnlyCode(meta), key, getKeyGolangType(meta))
+	}
+	if versioned {
+		upsertCode = fmt.Sprintf("if len(conflict) == 0 {\n\t\tconflict = []%sField{%sField%s}\n\t}\n\t", funcName, funcName, key) +
+			genUpsertVersionCode(meta, funcName, insertCode)
+	}
+
+	saveMany := fmt.Sprintf(`
+// saveMany 通过一条多行INSERT插入多条新记录，自增主键按顺序回填，已存在的记录需要通过UpdateMany更新
+func (q *query%s)saveMany(list []*Meta%s) error {
+	if q.err != nil {
+		return q.err
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	%s
+	%s
+	%s
+	%s
+}
+`, funcName, funcName, genValidateCallCode(meta, true, ""), genEachCode(genTouchCode(meta, "meta"), genKeyGenerateCode(meta, "meta")), genRouteManyCode(meta, ""), saveManyCode)
+	upsert := fmt.Sprintf(`
+// upsert 使用INSERT ... ON DUPLICATE KEY UPDATE写入，conflict字段用于识别记录，冲突时conflict字段和ctime不会被更新
+func (q *query%s)upsert(meta *Meta%s, conflict ...%sField) error {
+	if q.err != nil {
+		return q.err
+	}
+	%s
+	%s
+	%s
+	%s
+	%s
+}
+`, funcName, funcName, funcName, genValidateCallCode(meta, false, ""), genTouchCode(meta, "meta"), genKeyGenerateCode(meta, "meta"), genRouteMetaCode(meta), upsertCode)
+	updateMany := fmt.Sprintf(`
+// updateMany 在一条语句中按主键更新多条记录，有版本号时逐条按版本号更新
+func (q *query%s)updateMany(list []*Meta%s) (int64, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+	if len(list) == 0 {
+		return 0, nil
+	}
+	%s
+	%s
+	%s
+	%s
+}
+`, funcName, funcName, genValidateCallCode(meta, true, "0, "), genRouteManyCode(meta, "0, "), genUpdateManyTouchCode(meta), updateManyCode)
+	return genBatchMethods(meta, saveMany, upsert, updateMany)
+}
+
+// SaveMany、Upsert、UpdateMany依赖v0.4.5之后加入的驱动函数，框架没有提供时不生成；
+// 带版本号的Upsert和UpdateMany通过Update、Count和Save逐条写入，不依赖新的驱动函数
+func hasBatchAPI(meta Meta, name string) bool {
+	if _, versioned := getVersionField(meta); versioned && name != "SaveMany" {
+		return true
+	}
+	return hasDriveAPI(meta, name)
+}
+
+func genBatchMethods(meta Meta, saveMany, upsert, updateMany string) (code string) {
+	for _, m := range [][2]string{{"SaveMany", saveMany}, {"Upsert", upsert}, {"UpdateMany", updateMany}} {
+		if hasBatchAPI(meta, m[0]) {
+			code += m[1]
+		}
+	}
+	return
+}
+
+// 对list中每条记录执行的代码片段，没有需要执行的代码时不生成循环
+func genEachCode(lines ...string) string {
+	var body []string
+	for _, line := range lines {
+		if line != "" {
+			body = append(body, line)
+		}
+	}
+	if len(body) == 0 {
+		return ""
+	}
+	return "for _, meta := range list {\n\t\t" + strings.Join(body, "\n\t\t") + "\n\t}"
+}
+
+func genUpdateManyTouchCode(meta Meta) string {
+	field, err := getSpTTime(meta.Fields, "mtime")
+	if err != nil {
+		return ""
+	}
+	return "now := time.Now()\n\tfor _, meta := range list {\n\t\tmeta." + ucfirst(field.Name) + " = " + timeValueExpr(field, "now") + "\n\t}"
+}
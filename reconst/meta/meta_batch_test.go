@@ -0,0 +1,54 @@
+package meta
+
+import (
+	"os"
+	"testing"
+)
+
+func TestBatchWrites(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML})
+	for _, filename := range []string{"shop_user.go", "shop_order.go"} {
+		name := map[string]string{"shop_user.go": "queryShopUser", "shop_order.go": "queryShopOrder"}[filename]
+		assertDecls(t, sources, filename, name+".SaveMany", name+".Upsert", name+".UpdateMany", name+".Insert")
+	}
+	assertContains(t, sources, "shop_user.go",
+		"func (q *queryShopUser) Upsert(meta *MetaShopUser, conflict ...ShopUserField) error {",
+		"func (q *queryShopUser) UpdateMany(list []*MetaShopUser) (int64, error) {",
+	)
+}
+
+// 已发布的框架没有SaveMany、Upsert、UpdateMany，带版本号的Upsert和UpdateMany不依赖它们
+func TestBatchWritesNeedFramework(t *testing.T) {
+	dir := frameworkProject(t, true)
+	defer os.RemoveAll(dir)
+	sources, err := generateIn(t, dir, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML, "log.xml": testLogXML})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertDecls(t, sources, "shop_user.go", "queryShopUser.Upsert", "queryShopUser.UpdateMany", "queryShopUser.Insert")
+	assertNoDecls(t, sources, "shop_user.go", "queryShopUser.SaveMany", "shopUserStoreDriver.SaveMany", "shopUserStoreDriver.Upsert", "shopUserStoreDriver.UpdateMany")
+	assertNoDecls(t, sources, "shop_order.go", "queryShopOrder.SaveMany", "queryShopOrder.Upsert", "queryShopOrder.UpdateMany",
+		"ShopOrderMemoryStore.SaveMany", "ShopOrderMemoryStore.Upsert", "ShopOrderMemoryStore.UpdateMany")
+	assertNoDecls(t, sources, "audit_log.go", "queryAuditLog.SaveMany", "queryAuditLog.Upsert", "queryAuditLog.UpdateMany")
+}
+
+func TestMemoryUpsertDefaultsToKey(t *testing.T) {
+	buildProject(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML}, false, map[string]string{"upsert_test.go": `package db
+
+import "testing"
+
+func TestUpsert(t *testing.T) {
+	store := NewShopOrderMemoryStore(MetaShopOrder{Id: "o1", User_id: 1, Amount: 1})
+	defer UseShopOrderStore(store)()
+	if err := ShopOrder().Upsert(&MetaShopOrder{Id: "o1", User_id: 1, Amount: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if records := store.Records(); len(records) != 1 || records[0].Amount != 2 {
+		t.Errorf("Upsert without conflict should update by key: %+v", records)
+	}
+	if err := ShopOrder().Upsert(&MetaShopOrder{User_id: 1, Amount: 3}); err != nil || len(store.Records()) != 2 {
+		t.Errorf("Upsert of a new record should insert: %v, %+v", err, store.Records())
+	}
+}
+`})
+}
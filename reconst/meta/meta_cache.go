@@ -0,0 +1,175 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// <cache>为GetOne、GetList生成读穿透缓存：
+// type为lru时使用进程内缓存，size为最多缓存的查询数(默认1000)；type为redis时使用library/db中的RedisCache；
+// ttl为缓存秒数(默认60)；keys为可缓存的条件字段，多组之间用;分隔，例如"id;uid,day"，默认为主键。
+// 查询条件只包含某一组字段的Equal时读取缓存，Save、Update、Delete等写入后该meta的缓存全部失效，
+// 通过Tx执行的写入在提交后再失效一次，Use<Name>Store替换存储时同样失效
+var cacheTypes = []string{"lru", "redis"}
+
+const defaultCacheSize = 1000
+const defaultCacheTTL = 60
+
+// 缓存条件字段不支持的类型
+var cacheKeyTypes = []string{"object", "json", "bytes"}
+
+func cacheKeyGroups(meta Meta) (groups [][]string) {
+	if meta.Strategy.Cache.Keys == "" {
+		var keys []string
+		for _, key := range meta.Keys {
+			keys = append(keys, key.Name)
+		}
+		return [][]string{keys}
+	}
+	for _, group := range strings.Split(meta.Strategy.Cache.Keys, ";") {
+		var fields []string
+		for _, field := range strings.Split(group, ",") {
+			fields = append(fields, strings.TrimSpace(field))
+		}
+		groups = append(groups, fields)
+	}
+	return
+}
+
+func checkCache(meta Meta) error {
+	cache := meta.Strategy.Cache
+	if cache == nil {
+		return nil
+	}
+	if !inStrings(cacheTypes, cache.Type) {
+		return errors.New("cache type " + cache.Type + " must be one of " + strings.Join(cacheTypes, ", "))
+	}
+	if cache.TTL < 0 {
+		return errors.New("cache ttl must not be negative")
+	}
+	if cache.Size < 0 || cache.Size > 0 && cache.Type != "lru" {
+		return errors.New("cache size must be a positive number and is only supported by lru")
+	}
+
+	types := map[string]string{}
+	for _, key := range meta.Keys {
+		types[key.Name] = key.Type
+	}
+	for _, field := range meta.Fields.List {
+		types[field.Name] = field.Type
+	}
+	for _, group := range cacheKeyGroups(meta) {
+		seen := map[string]bool{}
+		for _, field := range group {
+			t, ok := types[field]
+			if field == "" {
+				return errors.New("cache keys " + meta.Strategy.Cache.Keys + " has empty field")
+			}
+			if !ok {
+				return errors.New("cache keys unknown field " + field)
+			}
+			if seen[field] {
+				return errors.New("cache keys duplicate field " + field)
+			}
+			if inStrings(cacheKeyTypes, t) || strings.HasPrefix(t, "array") || strings.HasPrefix(t, "map") {
+				return errors.New("cache keys field " + field + " of type " + t + " is not supported")
+			}
+			seen[field] = true
+		}
+	}
+	return nil
+}
+
+func genCacheCode(meta Meta, funcName string) string {
+	cache := meta.Strategy.Cache
+	if cache == nil {
+		return ""
+	}
+	varName := strings.ToLower(funcName[:1]) + funcName[1:] + "Cache"
+	var groups []string
+	for _, group := range cacheKeyGroups(meta) {
+		groups = append(groups, `{"`+strings.Join(group, `", "`)+`"}`)
+	}
+	ttl := cache.TTL
+	if ttl == 0 {
+		ttl = defaultCacheTTL
+	}
+
+	var code string
+	if cache.Type == "lru" {
+		size := cache.Size
+		if size == 0 {
+			size = defaultCacheSize
+		}
+		code = fmt.Sprintf("\nvar %s = newLRUCache(%d)\n", varName, size)
+	}
+	codec := "jsonCacheCodec"
+	if meta.Strategy.Storage.Type == "mongodb" {
+		codec = "bsonCacheCodec"
+	}
+	op := "op"
+	if _, ok := getSoftDeleteField(meta); ok {
+		op = "op + strconv.Itoa(q.trashed)"
+	}
+
+	// 事务中的查询不使用缓存，事务中的写入在提交后再失效一次，避免提交前其他请求读到的旧数据缓存在新版本下
+	var txRead, txInvalidate string
+	if hasTx(meta) {
+		txRead = "if q.query.Tx != nil {\n\t\treturn load()\n\t}\n\t"
+	}
+	if hasMysqlTx() {
+		txInvalidate = fmt.Sprintf("\n\tif q.query.Tx != nil {\n\t\t%s(q.query.Tx, func() { cacheInvalidate(q.cache(), \"%s.%s\") })\n\t}",
+			runtimeName(meta, "AfterCommit"), meta.Module, meta.Name)
+	}
+
+	return code + fmt.Sprintf(`
+var %sKeys = [][]string{%s}
+
+func (q *query%s)cache() Cache {
+	return %s
+}
+
+// cached 查询条件命中缓存字段时从缓存读取，否则执行load并写入缓存
+func (q *query%s)cached(op string, dest interface{}, load func() error) error {
+	%sreturn cacheLoad(q.cache(), %s, "%s.%s", %d*time.Second, %sKeys, %s, &q.query, dest, load)
+}
+
+// invalidateCache 写入后使%s.%s的缓存全部失效
+func (q *query%s)invalidateCache() {
+	cacheInvalidate(q.cache(), "%s.%s")%s
+}
+`, varName, strings.Join(groups, ", "), funcName, cacheStore(meta, funcName), funcName, txRead, codec, meta.Module, meta.Name, ttl, varName, op,
+		meta.Module, meta.Name, funcName, meta.Module, meta.Name, txInvalidate)
+}
+
+func cacheStore(meta Meta, funcName string) string {
+	if meta.Strategy.Cache.Type == "lru" {
+		return strings.ToLower(funcName[:1]) + funcName[1:] + "Cache"
+	}
+	return runtimeName(meta, "RedisCache")
+}
+
+// 替换存储后之前缓存的查询结果不再对应当前存储，使缓存全部失效
+func genCacheResetCode(meta Meta, funcName string) string {
+	if meta.Strategy.Cache == nil {
+		return ""
+	}
+	return fmt.Sprintf("\n\tcacheInvalidate(%s, \"%s.%s\")", cacheStore(meta, funcName), meta.Module, meta.Name)
+}
+
+// 查询驱动的调用，配置了缓存时通过cached读取
+func genCacheReadCode(meta Meta, op string, dest string, call string) string {
+	if meta.Strategy.Cache == nil {
+		return call
+	}
+	return fmt.Sprintf(`q.cached(%q, %s, func() error { return %s })`, op, dest, call)
+}
+
+// 写入方法开始时注册缓存失效，写入结束后执行
+func genCacheInvalidateCode(meta Meta) string {
+	if meta.Strategy.Cache == nil {
+		return ""
+	}
+	return "defer q.invalidateCache()"
+}
@@ -0,0 +1,100 @@
+package meta
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLRUCache(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML})
+	assertDecls(t, sources, "shop_user.go", "shopUserCache", "shopUserCacheKeys", "queryShopUser.cached", "queryShopUser.invalidateCache")
+	assertContains(t, sources, "shop_user.go",
+		"var shopUserCache = newLRUCache(100)",
+		`var shopUserCacheKeys = [][]string{{"id"}, {"name"}}`,
+		`cacheLoad(q.cache(), jsonCacheCodec, "shop.user", 60*time.Second, shopUserCacheKeys`,
+	)
+	// 事务中的写入在提交后再次失效缓存
+	invalidate := funcSource(t, sources, "shop_user.go", "queryShopUser.invalidateCache")
+	if !strings.Contains(invalidate, "AfterCommit(q.query.Tx, func() {") {
+		t.Errorf("invalidateCache should run again after commit:\n%s", invalidate)
+	}
+	for _, name := range []string{"Update", "Delete", "Save", "UpdateMany"} {
+		if src := funcSource(t, sources, "shop_user.go", "queryShopUser."+name); !strings.Contains(src, "q.invalidateCache()") {
+			t.Errorf("%s should invalidate the cache:\n%s", name, src)
+		}
+	}
+	assertNoDecls(t, sources, "shop_order.go", "queryShopOrder.cached")
+}
+
+func TestRedisCacheInSubpackage(t *testing.T) {
+	metas := testPackageMetas()
+	metas["order.xml"] = strings.Replace(metas["order.xml"], `</strategy>`, `<cache type="redis"/></strategy>`, 1)
+	sources := mustGenerate(t, metas)
+	assertDecls(t, sources, "common.go", "RedisCache")
+	assertContains(t, sources, "sales/shop_order.go", "return db.RedisCache", "db.AfterCommit(q.query.Tx, func() {")
+}
+
+func TestCheckCache(t *testing.T) {
+	tests := []struct {
+		cache string
+		err   string
+	}{
+		{`<cache type="memcache"/>`, "cache type memcache must be one of lru, redis"},
+		{`<cache type="redis" size="10"/>`, "cache size must be a positive number and is only supported by lru"},
+		{`<cache type="lru" keys="nope"/>`, "cache keys unknown field nope"},
+		{`<cache type="lru" keys="id,id"/>`, "cache keys duplicate field id"},
+		{`<cache type="lru" keys="tags"/>`, "cache keys field tags of type array:string is not supported"},
+	}
+	for _, tt := range tests {
+		src := strings.Replace(testUserXML, `<cache type="lru" ttl="60" size="100" keys="id;name"/>`, tt.cache, 1)
+		_, err := generateProject(t, map[string]string{"user.xml": src, "order.xml": testOrderXML})
+		assertError(t, err, tt.err)
+	}
+}
+
+// 命中缓存字段的GetOne只调用一次驱动，其他条件不缓存，写入后重新读取
+func TestLRUCacheRun(t *testing.T) {
+	buildProject(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML}, false, map[string]string{"cache_test.go": `package db
+
+import (
+	"testing"
+
+	"github.com/leochen2038/play/database/mysql"
+)
+
+func TestCache(t *testing.T) {
+	loads := func(fn func(q *queryShopUser) *queryShopUser) int {
+		mysql.Calls = nil
+		for i := 0; i < 2; i++ {
+			if _, err := fn(ShopUser()).GetOne(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return len(mysql.Calls)
+	}
+	byID := func(q *queryShopUser) *queryShopUser { return q.WhereIdEqual(1) }
+	if n := loads(byID); n != 1 {
+		t.Errorf("GetOne by id called the driver %d times, want 1", n)
+	}
+	if n := loads(byID); n != 0 {
+		t.Errorf("cached GetOne by id called the driver %d times, want 0", n)
+	}
+	if n := loads(func(q *queryShopUser) *queryShopUser { return q.WhereNameEqual("bob") }); n != 1 {
+		t.Errorf("GetOne by name called the driver %d times, want 1", n)
+	}
+	if n := loads(func(q *queryShopUser) *queryShopUser { return q.WhereAgeEqual(1) }); n != 2 {
+		t.Errorf("GetOne by age should not be cached, driver called %d times", n)
+	}
+	if n := loads(func(q *queryShopUser) *queryShopUser { return q.WhereIdEqual(1).WithTrashed() }); n != 1 {
+		t.Errorf("WithTrashed should be cached separately, driver called %d times", n)
+	}
+
+	if _, err := ShopUser().WhereIdEqual(1).SetAge(2).Update(); err != nil {
+		t.Fatal(err)
+	}
+	if n := loads(byID); n != 1 {
+		t.Errorf("GetOne after Update called the driver %d times, want 1", n)
+	}
+}
+`})
+}
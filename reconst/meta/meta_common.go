@@ -0,0 +1,997 @@
+package meta
+
+import (
+	"github.com/leochen2038/goplay/reconst/env"
+)
+
+// 所有meta共用的辅助代码，生成到每个包的common.go，有mongodb的meta时生成BSON编解码
+// 事务、雪花ID、Decimal、JSON、校验错误、钩子和缓存接口等共享的运行时只在library/db中生成一份，
+// 其他包通过别名和db包的导出函数使用同一份；内存存储、缓存读取等无状态的辅助函数每个包各生成一份
+func genCommonCode(pkg string, mongo bool, sharedMongo bool) string {
+	src, required := localCommonCode, []string(nil)
+	if pkg == "db" {
+		src = sharedCommonCode + src
+		required = append(required, `"`+env.FrameworkName+`"`)
+		if hasMysqlTx() {
+			src = txCommonCode + src
+			required = append(required, `"`+env.FrameworkName+`/database/mysql"`)
+		}
+		if sharedMongo {
+			src += decimalBSONCode
+		}
+	} else {
+		src = commonAliasCode + src
+	}
+	if mongo {
+		src += bsonCacheCode
+	}
+	return "package " + pkg + "\n" + genImports(required, src) + src
+}
+
+const sharedCommonCode = `
+// ErrStaleObject 乐观锁冲突，记录在读取之后已被其他请求修改
+var ErrStaleObject = errors.New("stale object: record has been modified by another request")
+
+// ErrDuplicateKey mysql的内存存储插入已存在的主键时返回，对应数据库的主键冲突
+var ErrDuplicateKey = errors.New("duplicate key: record with the same key already exists")
+
+// SnowflakeNode 雪花ID的节点号(0-1023)，多个实例同时写入时需要在启动时设置为不同的值
+var SnowflakeNode int64
+
+// 2020-01-01 00:00:00 UTC
+const snowflakeEpoch = 1577836800000
+
+var snowflake struct {
+	sync.Mutex
+	last int64
+	seq  int64
+}
+
+// NextSnowflake 生成41位毫秒时间戳、10位节点号、12位序号组成的ID，时钟回拨时沿用上次的时间戳
+func NextSnowflake() int64 {
+	snowflake.Lock()
+	defer snowflake.Unlock()
+
+	now := time.Now().UnixNano()/int64(time.Millisecond) - snowflakeEpoch
+	if now < snowflake.last {
+		now = snowflake.last
+	}
+	if now == snowflake.last {
+		snowflake.seq = (snowflake.seq + 1) & 4095
+		if snowflake.seq == 0 {
+			for now <= snowflake.last {
+				now = time.Now().UnixNano()/int64(time.Millisecond) - snowflakeEpoch
+			}
+		}
+	} else {
+		snowflake.seq = 0
+	}
+	snowflake.last = now
+	return now<<22 | (SnowflakeNode&1023)<<12 | snowflake.seq
+}
+
+// Decimal 以十进制字符串保存的定点数，mysql对应DECIMAL列，mongodb中保存为Decimal128，运算不会丢失精度
+type Decimal string
+
+var decimalPattern = regexp.MustCompile("^-?[0-9]+(\\.[0-9]+)?$")
+
+// NewDecimal 解析十进制数，如"12.50"、"-3"，不接受分数和指数形式
+func NewDecimal(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if !decimalPattern.MatchString(s) {
+		return "", errors.New("invalid decimal: " + s)
+	}
+	return Decimal(Decimal(s).rat().FloatString(Decimal(s).Scale())), nil
+}
+
+func (d Decimal) rat() *big.Rat {
+	r, ok := new(big.Rat).SetString(string(d))
+	if !ok {
+		return new(big.Rat)
+	}
+	return r
+}
+
+// Scale 小数位数
+func (d Decimal) Scale() int {
+	if i := strings.IndexByte(string(d), '.'); i >= 0 {
+		return len(d) - i - 1
+	}
+	return 0
+}
+
+func (d Decimal) Add(o Decimal) Decimal {
+	return Decimal(new(big.Rat).Add(d.rat(), o.rat()).FloatString(maxScale(d, o)))
+}
+
+func (d Decimal) Sub(o Decimal) Decimal {
+	return Decimal(new(big.Rat).Sub(d.rat(), o.rat()).FloatString(maxScale(d, o)))
+}
+
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal(new(big.Rat).Mul(d.rat(), o.rat()).FloatString(d.Scale() + o.Scale()))
+}
+
+// Div 结果保留scale位小数，四舍五入，除数为0时panic
+func (d Decimal) Div(o Decimal, scale int) Decimal {
+	return Decimal(new(big.Rat).Quo(d.rat(), o.rat()).FloatString(scale))
+}
+
+// Round 四舍五入保留scale位小数
+func (d Decimal) Round(scale int) Decimal {
+	return Decimal(d.rat().FloatString(scale))
+}
+
+// Cmp d<o返回-1，相等返回0，d>o返回1
+func (d Decimal) Cmp(o Decimal) int {
+	return d.rat().Cmp(o.rat())
+}
+
+func (d Decimal) IsZero() bool {
+	return d.rat().Sign() == 0
+}
+
+func (d Decimal) String() string {
+	if d == "" {
+		return "0"
+	}
+	return string(d)
+}
+
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+func (d *Decimal) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case nil:
+		*d = ""
+	case []byte:
+		*d = Decimal(data)
+	case string:
+		*d = Decimal(data)
+	case int64:
+		*d = Decimal(big.NewInt(data).String())
+	default:
+		return errors.New("Decimal: unsupported column type")
+	}
+	return nil
+}
+
+func maxScale(a, b Decimal) int {
+	if a.Scale() > b.Scale() {
+		return a.Scale()
+	}
+	return b.Scale()
+}
+
+// JSON mysql中JSON列的原始内容，序列化时原样输出
+type JSON []byte
+
+func (j JSON) Value() (driver.Value, error) {
+	if len(j) == 0 {
+		return nil, nil
+	}
+	return []byte(j), nil
+}
+
+func (j *JSON) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case nil:
+		*j = nil
+	case []byte:
+		*j = append((*j)[:0], data...)
+	case string:
+		*j = JSON(data)
+	default:
+		return errors.New("JSON: unsupported column type")
+	}
+	return nil
+}
+
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+func (j *JSON) UnmarshalJSON(data []byte) error {
+	*j = append((*j)[:0], data...)
+	return nil
+}
+
+// ValidationCode Validate返回的play.ErrorCode的错误码。框架的Render对没有错误码的错误返回0x100，
+// 校验错误使用紧随其后的0x101
+const ValidationCode = 0x101
+
+// ValidationError 字段不满足的校验规则
+type ValidationError struct {
+	Field   string
+	Rule    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// ValidationErrors ValidateFields返回的所有字段错误
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	list := make([]string, 0, len(e))
+	for _, v := range e {
+		list = append(list, v.Error())
+	}
+	return strings.Join(list, "; ")
+}
+
+// ErrorCode 转换为错误码是ValidationCode的play.ErrorCode，Render直接输出字段错误
+func (e ValidationErrors) ErrorCode() *play.ErrorCode {
+	return play.NewErrorCode(ValidationCode, e.Error())
+}
+
+// BeforeSaver Meta实现BeforeSave时，Save、Insert、SaveMany、Upsert、UpdateMany在写入前调用，返回错误时不写入
+type BeforeSaver interface {
+	BeforeSave() error
+}
+
+// AfterSaver Meta实现AfterSave时在写入成功后调用
+type AfterSaver interface {
+	AfterSave() error
+}
+
+// BeforeUpdater Update按条件更新，没有记录实例，以零值Meta和查询调用BeforeUpdate
+type BeforeUpdater interface {
+	BeforeUpdate(query *play.Query) error
+}
+
+// BeforeDeleter Delete、ForceDelete按条件删除，以零值Meta和查询调用BeforeDelete
+type BeforeDeleter interface {
+	BeforeDelete(query *play.Query) error
+}
+
+// AfterFinder Meta实现AfterFind时，GetOne、GetList、UpdateAndGetOne对查询到的每条记录调用
+type AfterFinder interface {
+	AfterFind() error
+}
+
+// Cache strategy中配置<cache>的meta通过Cache读取GetOne、GetList的结果
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	// Set ttl为0时不过期
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+// RedisCache cache type为redis的meta使用的缓存，需要在启动时设置为redis客户端的适配，未设置时直接查询数据库
+var RedisCache Cache
+`
+
+// 框架提供play.Query.Tx和mysql.Begin时生成的事务运行时
+const txCommonCode = `
+// txCommitted 通过Tx开启的事务提交后执行的回调，事务中写入的meta在提交后再使缓存失效一次
+var txCommitted = struct {
+	sync.Mutex
+	callbacks map[interface{}][]func()
+}{callbacks: map[interface{}][]func(){}}
+
+// AfterCommit 注册tx提交后执行的fn，tx不是通过Tx开启时(例如mongodb的session)无法得知提交时间，不注册
+func AfterCommit(tx interface{}, fn func()) {
+	txCommitted.Lock()
+	defer txCommitted.Unlock()
+	if list, ok := txCommitted.callbacks[tx]; ok {
+		txCommitted.callbacks[tx] = append(list, fn)
+	}
+}
+
+// Tx 在同一个mysql事务中执行fn，fn中的查询通过WithTx(tx)加入事务，fn返回错误或panic时回滚
+func Tx(database string, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := mysql.Begin(database)
+	if err != nil {
+		return err
+	}
+	txCommitted.Lock()
+	txCommitted.callbacks[tx] = nil
+	txCommitted.Unlock()
+	defer func() {
+		txCommitted.Lock()
+		callbacks := txCommitted.callbacks[tx]
+		delete(txCommitted.callbacks, tx)
+		txCommitted.Unlock()
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err == nil {
+			for _, callback := range callbacks {
+				callback()
+			}
+		}
+	}()
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+`
+
+// 其他包中的共享类型是library/db中类型的别名，错误是同一个值，SnowflakeNode、RedisCache等只需要在db包中设置
+const commonAliasCode = `
+// 事务、雪花ID、缓存等共享的运行时生成在library/db中，这里的类型是db包中类型的别名
+type (
+	Decimal          = db.Decimal
+	JSON             = db.JSON
+	Cache            = db.Cache
+	ValidationError  = db.ValidationError
+	ValidationErrors = db.ValidationErrors
+	BeforeSaver      = db.BeforeSaver
+	AfterSaver       = db.AfterSaver
+	BeforeUpdater    = db.BeforeUpdater
+	BeforeDeleter    = db.BeforeDeleter
+	AfterFinder      = db.AfterFinder
+)
+
+var (
+	ErrStaleObject  = db.ErrStaleObject
+	ErrDuplicateKey = db.ErrDuplicateKey
+)
+`
+
+const localCommonCode = `
+// 软删除记录的查询范围
+const (
+	trashedExclude = iota
+	trashedWith
+	trashedOnly
+)
+
+// 原生表达式中不允许出现字面量与注释，所有值必须通过?占位符传入
+func checkRawExpr(expr string, args []interface{}) error {
+	if strings.ContainsAny(expr, "'\";#\x60") || strings.Contains(expr, "--") || strings.Contains(expr, "/*") {
+		return errors.New("raw expression must not contain quotes, comments or statement separators: " + expr)
+	}
+	if strings.Count(expr, "?") != len(args) {
+		return errors.New("raw expression placeholders do not match arguments: " + expr)
+	}
+	return nil
+}
+
+// andConditions 返回conditions整体与extra同时满足的条件。group为true时把conditions放入Group，
+// 驱动不支持Group时按AND优先于OR把extra追加到每个OR分支，两者等价
+func andConditions(conditions []play.Condition, group bool, extra ...play.Condition) []play.Condition {
+	if len(conditions) == 0 {
+		return append([]play.Condition(nil), extra...)
+	}
+	if group {
+		return append([]play.Condition{{AndOr: true, Con: "Group", Val: conditions}}, extra...)
+	}
+	list := make([]play.Condition, 0, len(conditions)+len(extra))
+	for i, c := range conditions {
+		if i > 0 && !c.AndOr {
+			list = append(list, extra...)
+		}
+		list = append(list, c)
+	}
+	return append(list, extra...)
+}
+
+// shardValue 取分片字段Equal或In条件的值，In返回切片，同一层条件中出现OR时无法确定分片，返回nil
+func shardValue(conditions []play.Condition, field string) interface{} {
+	for i, c := range conditions {
+		if i > 0 && !c.AndOr {
+			return nil
+		}
+	}
+	for _, c := range conditions {
+		if c.Con == "Group" {
+			if sub, ok := c.Val.([]play.Condition); ok {
+				if v := shardValue(sub, field); v != nil {
+					return v
+				}
+			}
+		} else if c.Field == field && (c.Con == "Equal" || c.Con == "In") {
+			return c.Val
+		}
+	}
+	return nil
+}
+
+// newUUID 生成version为4(随机)或7(毫秒时间戳开头，按时间有序)的UUID
+func newUUID(version byte) string {
+	var b [16]byte
+	rand.Read(b[:])
+	if version == 7 {
+		ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+		for i := 0; i < 6; i++ {
+			b[i] = byte(ms >> uint(40-8*i))
+		}
+	}
+	b[6] = b[6]&0x0f | version<<4
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+var emailPattern = regexp.MustCompile("^[a-zA-Z0-9._%+\\-]+@[a-zA-Z0-9.\\-]+\\.[a-zA-Z]{2,}$")
+
+func beforeSave(meta interface{}) error {
+	if h, ok := meta.(BeforeSaver); ok {
+		return h.BeforeSave()
+	}
+	return nil
+}
+
+func afterSave(meta interface{}) error {
+	if h, ok := meta.(AfterSaver); ok {
+		return h.AfterSave()
+	}
+	return nil
+}
+
+func beforeUpdate(meta interface{}, query *play.Query) error {
+	if h, ok := meta.(BeforeUpdater); ok {
+		return h.BeforeUpdate(query)
+	}
+	return nil
+}
+
+func beforeDelete(meta interface{}, query *play.Query) error {
+	if h, ok := meta.(BeforeDeleter); ok {
+		return h.BeforeDelete(query)
+	}
+	return nil
+}
+
+func afterFind(meta interface{}) error {
+	if h, ok := meta.(AfterFinder); ok {
+		return h.AfterFind()
+	}
+	return nil
+}
+
+// lruCache 进程内缓存，超过size时淘汰最久未使用的记录
+type lruCache struct {
+	mu    sync.Mutex
+	size  int
+	list  *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key    string
+	value  []byte
+	expire time.Time
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{size: size, list: list.New(), items: map[string]*list.Element{}}
+}
+
+func (c *lruCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*lruEntry)
+	if !entry.expire.IsZero() && time.Now().After(entry.expire) {
+		c.list.Remove(e)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.list.MoveToFront(e)
+	return entry.value, true
+}
+
+func (c *lruCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &lruEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expire = time.Now().Add(ttl)
+	}
+	if e, ok := c.items[key]; ok {
+		e.Value = entry
+		c.list.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.list.PushFront(entry)
+	for c.list.Len() > c.size {
+		e := c.list.Back()
+		c.list.Remove(e)
+		delete(c.items, e.Value.(*lruEntry).key)
+	}
+}
+
+// cacheGeneration 缓存键中包含meta当前的版本，版本不存在(未写入过或已被淘汰)时生成新版本，旧的缓存不会再被读取
+func cacheGeneration(cache Cache, name string) string {
+	if gen, ok := cache.Get(name + ":gen"); ok {
+		return string(gen)
+	}
+	return cacheInvalidate(cache, name)
+}
+
+// cacheInvalidate 更换meta的缓存版本，之前缓存的查询全部失效
+func cacheInvalidate(cache Cache, name string) string {
+	if cache == nil {
+		return ""
+	}
+	gen := strconv.FormatInt(time.Now().UnixNano(), 36)
+	cache.Set(name+":gen", []byte(gen), 0)
+	return gen
+}
+
+// cacheKey 条件全部是AND连接的Equal，并且字段正好是keys中的一组时返回缓存键，否则不缓存
+func cacheKey(query *play.Query, keys [][]string) (string, bool) {
+	values := map[string]interface{}{}
+	for i, c := range query.Conditions {
+		if i > 0 && !c.AndOr || c.Con != "Equal" {
+			return "", false
+		}
+		if _, ok := values[c.Field]; ok {
+			return "", false
+		}
+		values[c.Field] = c.Val
+	}
+	for _, group := range keys {
+		if len(group) != len(values) {
+			continue
+		}
+		key := ""
+		for _, field := range group {
+			v, ok := values[field]
+			if !ok {
+				key = ""
+				break
+			}
+			key += fmt.Sprintf(":%s=%#v", field, v)
+		}
+		if key == "" {
+			continue
+		}
+		fields := make([]string, 0, len(query.Fields))
+		for field, ok := range query.Fields {
+			if ok {
+				fields = append(fields, field)
+			}
+		}
+		sort.Strings(fields)
+		return key + fmt.Sprintf("|%s|%v|%v|%v", strings.Join(fields, ","), query.Order, query.Group, query.Limit), true
+	}
+	return "", false
+}
+
+// cacheCodec 缓存结果的编码方式，解码后的类型需要与驱动读取的一致
+type cacheCodec struct {
+	marshal   func(v interface{}) ([]byte, error)
+	unmarshal func(data []byte, v interface{}) error
+}
+
+var jsonCacheCodec = cacheCodec{json.Marshal, json.Unmarshal}
+
+// cacheLoad 命中缓存时把缓存的结果解码到dest，否则调用load查询并缓存结果
+func cacheLoad(cache Cache, codec cacheCodec, name string, ttl time.Duration, keys [][]string, op string, query *play.Query, dest interface{}, load func() error) error {
+	if cache == nil {
+		return load()
+	}
+	key, ok := cacheKey(query, keys)
+	if !ok {
+		return load()
+	}
+	key = name + ":" + cacheGeneration(cache, name) + ":" + op + key
+	if data, ok := cache.Get(key); ok && codec.unmarshal(data, dest) == nil {
+		return nil
+	}
+	if err := load(); err != nil {
+		return err
+	}
+	if data, err := codec.marshal(dest); err == nil {
+		cache.Set(key, data, ttl)
+	}
+	return nil
+}
+
+// memoryMatch 在内存中按与数据库相同的语义判断记录是否满足条件，AND优先于OR
+func memoryMatch(conditions []play.Condition, value func(field string) interface{}) (bool, error) {
+	result, group := false, true
+	for i, c := range conditions {
+		if i > 0 && !c.AndOr {
+			result, group = result || group, true
+		}
+		if !group {
+			continue
+		}
+		ok, err := memoryCondition(c, value)
+		if err != nil {
+			return false, err
+		}
+		group = ok
+	}
+	return result || group, nil
+}
+
+func memoryCondition(c play.Condition, value func(field string) interface{}) (bool, error) {
+	if c.Con == "Group" {
+		sub, _ := c.Val.([]play.Condition)
+		return memoryMatch(sub, value)
+	}
+	v := value(c.Field)
+	switch c.Con {
+	case "IsNull", "IsNotNull":
+		return memoryIsNull(v) == (c.Con == "IsNull"), nil
+	case "Equal":
+		return memoryCompare(v, c.Val) == 0, nil
+	case "NotEqual":
+		return memoryCompare(v, c.Val) != 0, nil
+	case "Less":
+		return memoryCompare(v, c.Val) < 0, nil
+	case "LessOrEqual":
+		return memoryCompare(v, c.Val) <= 0, nil
+	case "Greater":
+		return memoryCompare(v, c.Val) > 0, nil
+	case "GreaterOrEqual":
+		return memoryCompare(v, c.Val) >= 0, nil
+	case "Like", "NotLike":
+		pattern, _ := c.Val.(string)
+		return memoryLike(fmt.Sprint(v), pattern) == (c.Con == "Like"), nil
+	case "Between", "NotBetween":
+		r, _ := c.Val.([2]interface{})
+		ok := memoryCompare(v, r[0]) >= 0 && memoryCompare(v, r[1]) <= 0
+		return ok == (c.Con == "Between"), nil
+	case "In", "NotIn":
+		ok, list := false, reflect.ValueOf(c.Val)
+		for i := 0; list.Kind() == reflect.Slice && i < list.Len() && !ok; i++ {
+			ok = memoryCompare(v, list.Index(i).Interface()) == 0
+		}
+		return ok == (c.Con == "In"), nil
+	}
+	return false, errors.New("memory store does not support condition " + c.Con)
+}
+
+func memoryKind(v reflect.Value) byte {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return 'i'
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return 'u'
+	case reflect.Float32, reflect.Float64:
+		return 'f'
+	case reflect.String:
+		return 's'
+	case reflect.Bool:
+		return 'b'
+	}
+	return 0
+}
+
+func memoryFloat(v reflect.Value) float64 {
+	switch memoryKind(v) {
+	case 'i':
+		return float64(v.Int())
+	case 'u':
+		return float64(v.Uint())
+	case 'f':
+		return v.Float()
+	}
+	return 0
+}
+
+func memoryBigInt(v reflect.Value) *big.Int {
+	switch memoryKind(v) {
+	case 'i':
+		return big.NewInt(v.Int())
+	case 'u':
+		return new(big.Int).SetUint64(v.Uint())
+	}
+	n, _ := big.NewFloat(memoryFloat(v)).Int(nil)
+	return n
+}
+
+// memoryCompare 比较两个字段值，enum等命名类型按底层类型比较
+func memoryCompare(a, b interface{}) int {
+	switch x := a.(type) {
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			if x.Before(y) {
+				return -1
+			} else if x.After(y) {
+				return 1
+			}
+			return 0
+		}
+	case Decimal:
+		if y, ok := b.(Decimal); ok {
+			return x.Cmp(y)
+		}
+	case interface{ Hex() string }:
+		if y, ok := b.(interface{ Hex() string }); ok {
+			return strings.Compare(x.Hex(), y.Hex())
+		}
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	ka, kb := memoryKind(va), memoryKind(vb)
+	switch {
+	case ka == 'i' && kb == 'i':
+		if va.Int() != vb.Int() {
+			if va.Int() < vb.Int() {
+				return -1
+			}
+			return 1
+		}
+		return 0
+	case ka == 'u' && kb == 'u':
+		if va.Uint() != vb.Uint() {
+			if va.Uint() < vb.Uint() {
+				return -1
+			}
+			return 1
+		}
+		return 0
+	case ka != 0 && ka != 's' && ka != 'b' && kb != 0 && kb != 's' && kb != 'b':
+		if fa, fb := memoryFloat(va), memoryFloat(vb); fa != fb {
+			if fa < fb {
+				return -1
+			}
+			return 1
+		}
+		return 0
+	case ka == 's' && kb == 's':
+		return strings.Compare(va.String(), vb.String())
+	case ka == 'b' && kb == 'b':
+		if va.Bool() == vb.Bool() {
+			return 0
+		} else if vb.Bool() {
+			return -1
+		}
+		return 1
+	}
+	if reflect.DeepEqual(a, b) {
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// memoryIsNull 只有指针、map、切片等可以为nil的值才对应NULL，数值0和空字符串不是NULL
+func memoryIsNull(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// memoryLike 按LIKE的语义匹配，%匹配任意字符串，_匹配单个字符，不区分大小写
+func memoryLike(s string, pattern string) bool {
+	expr := "(?is)^"
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			expr += ".*"
+		case '_':
+			expr += "."
+		default:
+			expr += regexp.QuoteMeta(string(r))
+		}
+	}
+	ok, _ := regexp.MatchString(expr+"$", s)
+	return ok
+}
+
+// memorySort 按query.Order对记录下标排序
+func memorySort(indexes []int, order [][2]string, value func(i int, field string) interface{}) {
+	sort.SliceStable(indexes, func(i, j int) bool {
+		for _, o := range order {
+			if c := memoryCompare(value(indexes[i], o[0]), value(indexes[j], o[0])); c != 0 {
+				return (c < 0) != strings.EqualFold(o[1], "desc")
+			}
+		}
+		return false
+	})
+}
+
+// memoryLimit 按query.Limit计算结果的范围，count为0时不限制条数
+func memoryLimit(n int, limit [2]int64) (int, int) {
+	start, end := int(limit[0]), n
+	if start > n {
+		start = n
+	}
+	if limit[1] > 0 && start+int(limit[1]) < n {
+		end = start + int(limit[1])
+	}
+	return start, end
+}
+
+// memorySetValue 计算query.Sets中字段的新值，opt为+或-时在原值上增减
+func memorySetValue(cur interface{}, args []interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return cur, errors.New("memory store: empty set value")
+	}
+	if len(args) < 2 {
+		return args[0], nil
+	}
+	opt, _ := args[1].(string)
+	if opt != "+" && opt != "-" {
+		return cur, errors.New("memory store does not support set option " + opt)
+	}
+	if d, ok := cur.(Decimal); ok {
+		delta, _ := args[0].(Decimal)
+		if opt == "-" {
+			return d.Sub(delta), nil
+		}
+		return d.Add(delta), nil
+	}
+
+	c, delta := reflect.ValueOf(cur), reflect.ValueOf(args[0])
+	sign := 1.0
+	if opt == "-" {
+		sign = -1
+	}
+	result := reflect.New(c.Type()).Elem()
+	switch memoryKind(c) {
+	case 'i', 'u':
+		// 整数按big.Int计算，uint64超过MaxInt64的值不会溢出，结果超出字段类型的范围时与数据库一样报错
+		n, d := memoryBigInt(c), memoryBigInt(delta)
+		if opt == "-" {
+			n.Sub(n, d)
+		} else {
+			n.Add(n, d)
+		}
+		if memoryKind(c) == 'u' && (!n.IsUint64() || result.OverflowUint(n.Uint64())) ||
+			memoryKind(c) == 'i' && (!n.IsInt64() || result.OverflowInt(n.Int64())) {
+			return cur, errors.New("memory store: value out of range of " + c.Type().String())
+		}
+		if memoryKind(c) == 'u' {
+			result.SetUint(n.Uint64())
+		} else {
+			result.SetInt(n.Int64())
+		}
+	case 'f':
+		result.SetFloat(c.Float() + sign*memoryFloat(delta))
+	default:
+		return cur, errors.New("memory store can not increase a non-numeric value")
+	}
+	return result.Interface(), nil
+}
+
+// memoryAggregate 在内存中计算sum、avg、min、max，结果写入dest
+func memoryAggregate(dest interface{}, fn string, values []interface{}) error {
+	out := reflect.ValueOf(dest).Elem()
+	switch fn {
+	case "sum", "avg":
+		var sum float64
+		var sumInt int64
+		var sumUint uint64
+		var sumDecimal Decimal
+		for _, v := range values {
+			rv := reflect.ValueOf(v)
+			sum += memoryFloat(rv)
+			switch memoryKind(rv) {
+			case 'i':
+				sumInt += rv.Int()
+			case 'u':
+				sumUint += rv.Uint()
+			}
+			if d, ok := v.(Decimal); ok {
+				sumDecimal = sumDecimal.Add(d)
+			}
+		}
+		if d, ok := dest.(*Decimal); ok {
+			// 与mysql一致，decimal的平均值比字段多保留4位小数
+			*d = sumDecimal
+			if fn == "avg" && len(values) > 0 {
+				*d = sumDecimal.Div(Decimal(strconv.Itoa(len(values))), sumDecimal.Scale()+4)
+			}
+		} else if fn == "avg" {
+			if len(values) > 0 {
+				out.SetFloat(sum / float64(len(values)))
+			}
+		} else if memoryKind(out) == 'i' {
+			out.SetInt(sumInt)
+		} else if memoryKind(out) == 'u' {
+			out.SetUint(sumUint)
+		} else {
+			out.SetFloat(sum)
+		}
+		return nil
+	case "min", "max":
+		var best interface{}
+		for _, v := range values {
+			if c := memoryCompare(v, best); best == nil || fn == "min" && c < 0 || fn == "max" && c > 0 {
+				best = v
+			}
+		}
+		if best != nil {
+			out.Set(reflect.ValueOf(best))
+		}
+		return nil
+	}
+	return errors.New("memory store does not support aggregate " + fn)
+}
+
+// memoryGroupCount 按取值分组计数，结果写入dest(map[T]int64)
+func memoryGroupCount(dest interface{}, values []interface{}) error {
+	out := reflect.ValueOf(dest).Elem()
+	if out.IsNil() {
+		out.Set(reflect.MakeMap(out.Type()))
+	}
+	for _, v := range values {
+		key, count := reflect.ValueOf(v), int64(1)
+		if n := out.MapIndex(key); n.IsValid() {
+			count += n.Int()
+		}
+		out.SetMapIndex(key, reflect.ValueOf(count))
+	}
+	return nil
+}
+`
+
+// mongodb中Decimal保存为Decimal128，按数值比较和排序，兼容读取以字符串保存的旧数据
+const decimalBSONCode = `
+func (d Decimal) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	v, err := primitive.ParseDecimal128(d.String())
+	if err != nil {
+		return 0, nil, err
+	}
+	return bson.MarshalValue(v)
+}
+
+func (d *Decimal) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+	if t == bsontype.Null {
+		*d = ""
+		return nil
+	}
+	if s, ok := raw.StringValueOK(); ok {
+		*d = Decimal(s)
+		return nil
+	}
+	v, ok := raw.Decimal128OK()
+	if !ok {
+		return errors.New("Decimal: unsupported bson type " + t.String())
+	}
+	i, exp, err := v.BigInt()
+	if err != nil {
+		return err
+	}
+	r, scale := new(big.Rat).SetInt(i), 0
+	if exp < 0 {
+		r.Quo(r, decimalPow10(-exp))
+		scale = -exp
+	} else {
+		r.Mul(r, decimalPow10(exp))
+	}
+	*d = Decimal(r.FloatString(scale))
+	return nil
+}
+
+func decimalPow10(n int) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil))
+}
+`
+
+// mongodb的meta用bson缓存结果，json字段与驱动读取的一样解码为primitive.D、int32等类型，而不是json的map与float64
+const bsonCacheCode = `
+var bsonCacheCodec = cacheCodec{bsonCacheMarshal, bsonCacheUnmarshal}
+
+func bsonCacheMarshal(v interface{}) ([]byte, error) {
+	return bson.Marshal(bson.M{"v": v})
+}
+
+func bsonCacheUnmarshal(data []byte, v interface{}) error {
+	value, err := bson.Raw(data).LookupErr("v")
+	if err != nil {
+		return err
+	}
+	return value.Unmarshal(v)
+}
+`
+
+func writeCommon(pkg string, mongo bool, sharedMongo bool) error {
+	return writeSource(pkg, "common", "common.go", genCommonCode(pkg, mongo, sharedMongo))
+}
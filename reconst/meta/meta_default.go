@@ -0,0 +1,179 @@
+package meta
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 默认值在生成代码时解析为go表达式，NewMeta中使用：
+// 数值、bool、string、decimal按类型解析；时间字段支持now或2006-01-02[ 15:04:05]格式；
+// array:<type>和map:<type>使用json格式，例如["a","b"]、{"a":1}；json字段为json文档；enum为取值的名字
+var decimalExp = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+var uintBits = map[string]int{"uint": strconv.IntSize, "uint8": 8, "uint16": 16, "uint32": 32, "uint64": 64}
+var intBits = map[string]int{"int": strconv.IntSize, "int64": 64}
+
+var timeLayouts = []string{"2006-01-02 15:04:05", "2006-01-02"}
+
+func scalarDefaultExpr(t string, s string) (string, error) {
+	var err error
+	switch t {
+	case "int", "int64":
+		_, err = strconv.ParseInt(s, 10, intBits[t])
+	case "uint", "uint8", "uint16", "uint32", "uint64":
+		_, err = strconv.ParseUint(s, 10, uintBits[t])
+	case "float":
+		var f float64
+		if f, err = strconv.ParseFloat(s, 64); err == nil && (math.IsInf(f, 0) || math.IsNaN(f)) {
+			err = errors.New("invalid float")
+		}
+	case "bool":
+		var b bool
+		b, err = strconv.ParseBool(s)
+		s = strconv.FormatBool(b)
+	case "decimal":
+		if !decimalExp.MatchString(s) {
+			err = errors.New("invalid decimal")
+		}
+		s = strconv.Quote(s)
+	case "string":
+		s = strconv.Quote(s)
+	default:
+		return "", errors.New("not supported by type " + t)
+	}
+	if err != nil {
+		return "", errors.New("is not a valid " + t)
+	}
+	return s, nil
+}
+
+func timeDefaultExpr(field MetaField) (string, error) {
+	if field.Default == "now" && isDateType(field.Type) {
+		return "time.Now()", nil
+	}
+	if field.Default == "now" {
+		return timeValueExpr(field, "time.Now()"), nil
+	}
+	if isTimeType(field.Type) && field.Unit != "time" {
+		if _, err := strconv.ParseInt(field.Default, 10, 64); err != nil {
+			return "", errors.New("must be now or a unix timestamp")
+		}
+		return field.Default, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, field.Default, time.Local); err == nil {
+			return fmt.Sprintf("time.Date(%d, %d, %d, %d, %d, %d, 0, time.Local)", t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second()), nil
+		}
+	}
+	return "", errors.New("must be now or formatted as " + strings.Join(timeLayouts, " or "))
+}
+
+// json格式的数组和map默认值，元素按元素类型解析，map的键按字母序输出
+func collectionDefaultExpr(field MetaField) (string, error) {
+	goType := getFieldGolangType(field)
+	elem := field.Type[strings.Index(field.Type, ":")+1:]
+	if !inStrings(collectionElemTypes, elem) {
+		return "", errors.New("not supported by type " + field.Type)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(field.Default)))
+	decoder.UseNumber()
+	var values []string
+	if strings.HasPrefix(field.Type, "array:") {
+		var list []interface{}
+		if err := decoder.Decode(&list); err != nil {
+			return "", errors.New("must be a json array")
+		}
+		for _, v := range list {
+			expr, err := jsonDefaultElem(elem, v)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, expr)
+		}
+	} else {
+		var m map[string]interface{}
+		if err := decoder.Decode(&m); err != nil {
+			return "", errors.New("must be a json object")
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			expr, err := jsonDefaultElem(elem, m[k])
+			if err != nil {
+				return "", err
+			}
+			values = append(values, strconv.Quote(k)+": "+expr)
+		}
+	}
+	return goType + "{" + strings.Join(values, ", ") + "}", nil
+}
+
+// 支持默认值的数组和map元素类型
+var collectionElemTypes = []string{"int", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "float", "bool", "decimal", "string"}
+
+func jsonDefaultElem(elem string, v interface{}) (string, error) {
+	// string元素必须是json字符串，decimal可以是字符串或数字
+	var s string
+	var valid bool
+	switch value := v.(type) {
+	case json.Number:
+		s, valid = value.String(), elem != "string" && elem != "bool"
+	case bool:
+		s, valid = strconv.FormatBool(value), elem == "bool"
+	case string:
+		s, valid = value, elem == "string" || elem == "decimal"
+	}
+	expr, err := scalarDefaultExpr(elem, s)
+	if !valid || err != nil {
+		return "", fmt.Errorf("element %v is not a valid %s", v, elem)
+	}
+	return expr, nil
+}
+
+// 字段默认值的go表达式，没有默认值时返回空字符串
+func defaultValueExpr(field MetaField) (string, error) {
+	if field.Default == "" {
+		return "", nil
+	}
+	switch {
+	case isEnumType(field.Type):
+		return field.goType + formatUcfirstName(field.Default), nil
+	case isTimeType(field.Type) || isDateType(field.Type):
+		return timeDefaultExpr(field)
+	case field.Type == "json":
+		if !json.Valid([]byte(field.Default)) {
+			return "", errors.New("is not a valid json")
+		}
+		return "JSON(" + strconv.Quote(field.Default) + ")", nil
+	case strings.HasPrefix(field.Type, "array:") || strings.HasPrefix(field.Type, "map:"):
+		return collectionDefaultExpr(field)
+	}
+	return scalarDefaultExpr(field.Type, field.Default)
+}
+
+func checkDefault(field MetaField) error {
+	_, err := defaultValueExpr(field)
+	return err
+}
+
+func metaDefaultValue(list []MetaField) string {
+	var s []string
+	for _, field := range list {
+		if expr, err := defaultValueExpr(field); err == nil && expr != "" {
+			s = append(s, fmt.Sprintf(`%s:%s`, ucfirst(field.Name), expr))
+		}
+	}
+	return strings.Join(s, ", ")
+}
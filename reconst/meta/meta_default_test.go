@@ -0,0 +1,69 @@
+package meta
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewMetaDefaults(t *testing.T) {
+	const stockXML = `<meta module="shop" name="stock">
+  <key name="sku" type="string"/>
+  <fields>
+    <field name="born" type="datetime" default="2020-01-02"/>
+    <field name="flag" type="bool" default="true"/>
+    <field name="doc" type="json" default="{&quot;a&quot;:1}"/>
+    <field name="tags" type="array:string" default="[&quot;x&quot;]"/>
+    <field name="level" type="uint8" default="3"/>
+  </fields>
+  <strategy>
+    <storage type="mysql" database="shop" table="stock"/>
+  </strategy>
+</meta>
+`
+	sources := mustGenerate(t, map[string]string{"stock.xml": stockXML})
+	newMeta := funcSource(t, sources, "shop_stock.go", "queryShopStock.NewMeta")
+	for _, want := range []string{
+		"Born: time.Date(2020, 1, 2, 0, 0, 0, 0, time.Local)",
+		"Flag: true",
+		`Doc: JSON("{\"a\":1}")`,
+		`Tags: []string{"x"}`,
+		"Level: 3",
+	} {
+		if !strings.Contains(newMeta, want) {
+			t.Errorf("NewMeta does not contain %s:\n%s", want, newMeta)
+		}
+	}
+
+	sources = mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML})
+	assertContains(t, sources, "shop_user.go", `return &MetaShopUser{Name: "anon", Balance: "0.00"}`)
+}
+
+func TestCheckDefault(t *testing.T) {
+	tests := []struct {
+		field MetaField
+		err   string
+	}{
+		{MetaField{Name: "n", Type: "int", Default: "x"}, "is not a valid int"},
+		{MetaField{Name: "n", Type: "uint8", Default: "256"}, "is not a valid uint8"},
+		{MetaField{Name: "n", Type: "int64", Default: "9223372036854775808"}, "is not a valid int64"},
+		{MetaField{Name: "n", Type: "bool", Default: "yes"}, "is not a valid bool"},
+		{MetaField{Name: "n", Type: "decimal", Default: "1e3"}, "is not a valid decimal"},
+		{MetaField{Name: "n", Type: "ctime", Default: "yesterday"}, "must be now or a unix timestamp"},
+		{MetaField{Name: "n", Type: "array:int", Default: "{}"}, "must be a json array"},
+		{MetaField{Name: "n", Type: "datetime", Default: "yesterday"}, "must be now or formatted as"},
+		{MetaField{Name: "n", Type: "json", Default: "{"}, "is not a valid json"},
+	}
+	for _, tt := range tests {
+		assertError(t, checkDefault(tt.field), tt.err)
+	}
+	for _, field := range []MetaField{
+		{Name: "n", Type: "int", Default: "-3"},
+		{Name: "n", Type: "datetime", Default: "now"},
+		{Name: "n", Type: "ctime", Default: "now"},
+		{Name: "n", Type: "decimal", Default: "1.50"},
+	} {
+		if err := checkDefault(field); err != nil {
+			t.Errorf("%s default %q: %v", field.Type, field.Default, err)
+		}
+	}
+}
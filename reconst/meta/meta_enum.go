@@ -0,0 +1,188 @@
+package meta
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// enum字段的取值存储为int，enum:string存储为string，通过<value>列出允许的取值
+var enumTypes = map[string]string{
+	"enum":        "int",
+	"enum:string": "string",
+}
+
+type MetaEnumValue struct {
+	Name  string `xml:"name,attr" json:"name" yaml:"name"`
+	Value string `xml:"value,attr" json:"value" yaml:"value"`
+	Note  string `xml:"note,attr,omitempty" json:"note,omitempty" yaml:"note,omitempty"`
+}
+
+func isEnumType(t string) bool {
+	_, ok := enumTypes[t]
+	return ok
+}
+
+func getEnumFields(meta Meta) (list []MetaField) {
+	for _, field := range meta.Fields.List {
+		if isEnumType(field.Type) {
+			list = append(list, field)
+		}
+	}
+	return
+}
+
+// enum字段生成以meta名和字段名命名的类型
+func prepareEnumFields(fields []MetaField, funcName string) []MetaField {
+	list := make([]MetaField, 0, len(fields))
+	for _, field := range fields {
+		if isEnumType(field.Type) {
+			field.goType = funcName + formatUcfirstName(field.Name)
+		}
+		list = append(list, field)
+	}
+	return list
+}
+
+func enumConstName(field MetaField, value MetaEnumValue) string {
+	return field.goType + formatUcfirstName(value.Name)
+}
+
+func enumValueExpr(field MetaField, value MetaEnumValue) string {
+	if enumTypes[field.Type] == "string" {
+		return strconv.Quote(value.Value)
+	}
+	return value.Value
+}
+
+func checkEnumField(field MetaField, line int, verr *validateErrors) {
+	if !isEnumType(field.Type) {
+		if len(field.Values) > 0 {
+			verr.addLine(line, "field %q values are only supported by enum and enum:string", field.Name)
+		}
+		return
+	}
+	if len(field.Values) == 0 {
+		verr.addLine(line, "field %q type %s requires values", field.Name, field.Type)
+	}
+
+	names, values := map[string]bool{}, map[string]bool{}
+	for _, v := range field.Values {
+		if !isExportedIdent(formatUcfirstName(v.Name)) {
+			verr.addLine(line, "field %q enum name %q is not a valid go identifier", field.Name, v.Name)
+		}
+		if names[formatUcfirstName(v.Name)] {
+			verr.addLine(line, "field %q duplicate enum name %q", field.Name, v.Name)
+		}
+		if values[v.Value] {
+			verr.addLine(line, "field %q duplicate enum value %q", field.Name, v.Value)
+		}
+		names[formatUcfirstName(v.Name)], values[v.Value] = true, true
+		if enumTypes[field.Type] == "int" {
+			if _, err := strconv.ParseInt(v.Value, 10, strconv.IntSize); err != nil {
+				verr.addLine(line, "field %q enum %q value %q is not a valid int", field.Name, v.Name, v.Value)
+			}
+		}
+	}
+	if field.Default != "" && !names[formatUcfirstName(field.Default)] {
+		verr.addLine(line, "field %q default %q is not one of the enum names", field.Name, field.Default)
+	}
+}
+
+// enum类型和常量都以meta名为前缀，不能与同前缀的生成类型和字段名常量重名
+func checkEnumNames(meta Meta, lines metaLines, verr *validateErrors) {
+	declared := map[string]string{}
+	for _, name := range []string{"Field", "Store", "MemoryStore"} {
+		declared[name] = "the generated type " + name
+	}
+	for _, key := range meta.Keys {
+		declared["Field"+formatUcfirstName(key.Name)] = fmt.Sprintf("the field name constant of %q", key.Name)
+	}
+	for _, field := range meta.Fields.List {
+		declared["Field"+formatUcfirstName(field.Name)] = fmt.Sprintf("the field name constant of %q", field.Name)
+	}
+	for i, field := range meta.Fields.List {
+		if !isEnumType(field.Type) {
+			continue
+		}
+		line, name := lines.line(lines.fields, i), formatUcfirstName(field.Name)
+		if prev, ok := declared[name]; ok {
+			verr.addLine(line, "enum field %q type name conflicts with %s", field.Name, prev)
+		}
+		declared[name] = fmt.Sprintf("the enum type of %q", field.Name)
+		for _, v := range field.Values {
+			desc := fmt.Sprintf("enum %q of field %q", v.Name, field.Name)
+			// 同一字段内的重名已由checkEnumField报告
+			if prev, ok := declared[name+formatUcfirstName(v.Name)]; ok && prev != desc {
+				verr.addLine(line, "field %q enum name %q conflicts with %s", field.Name, v.Name, prev)
+			}
+			declared[name+formatUcfirstName(v.Name)] = desc
+		}
+	}
+}
+
+func genEnumCode(meta Meta, funcName string) (code string) {
+	for _, field := range getEnumFields(meta) {
+		name := field.goType
+		var consts, names, parses, valids string
+		for _, v := range field.Values {
+			constName := enumConstName(field, v)
+			if v.Note != "" {
+				consts += fmt.Sprintf("\t%s %s = %s // %s\n", constName, name, enumValueExpr(field, v), v.Note)
+			} else {
+				consts += fmt.Sprintf("\t%s %s = %s\n", constName, name, enumValueExpr(field, v))
+			}
+			names += fmt.Sprintf("\tcase %s:\n\t\treturn \"%s\"\n", constName, v.Name)
+			parses += fmt.Sprintf("\tcase \"%s\":\n\t\treturn %s, nil\n", v.Name, constName)
+			valids += ", " + constName
+		}
+
+		zero, unknown := "0", "strconv.Itoa(int(v))"
+		if enumTypes[field.Type] == "string" {
+			zero, unknown = `""`, "string(v)"
+		}
+
+		code += fmt.Sprintf(`
+// %s %s
+type %s %s
+
+const (
+%s)
+
+// String 返回取值的名字，不在取值范围内时返回原始值
+func (v %s) String() string {
+	switch v {
+%s	}
+	return %s
+}
+
+// Parse%s 按名字解析取值
+func Parse%s(name string) (%s, error) {
+	switch name {
+%s	}
+	return %s, errors.New("%s.%s: unknown %s " + name)
+}
+
+func (v %s) Valid() bool {
+	switch v {
+	case %s:
+		return true
+	}
+	return false
+}
+`, name, field.Note, name, enumTypes[field.Type], consts,
+			name, names, unknown,
+			name, name, name, parses, zero, meta.Module, meta.Name, field.Name,
+			name, valids[2:])
+	}
+	return
+}
+
+// query的Set方法在取值不合法时记录错误，在执行时返回
+func genEnumSetCheckCode(meta Meta, field MetaField) string {
+	if !isEnumType(field.Type) {
+		return ""
+	}
+	return fmt.Sprintf(`if !val.Valid() {
+		q.err = errors.New("%s.%s: invalid %s " + val.String())
+	}`, meta.Module, meta.Name, field.Name)
+}
@@ -0,0 +1,36 @@
+package meta
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEnumTypes(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML, "log.xml": testLogXML})
+	assertDecls(t, sources, "shop_user.go", "ShopUserStatus", "ShopUserStatusActive", "ShopUserStatusBanned",
+		"ShopUserStatus.String", "ShopUserStatus.Valid", "ParseShopUserStatus")
+	assertContains(t, sources, "shop_user.go",
+		"ShopUserStatusActive ShopUserStatus = 1",
+		"Status  ShopUserStatus  `db:\"status\"`",
+		`errs = append(errs, &ValidationError{Field: "status", Rule: "enum", Message: "invalid value " + meta.Status.String()})`,
+	)
+	assertContains(t, sources, "audit_log.go", "type AuditLogLevel string", `AuditLogLevelInfo AuditLogLevel = "info"`)
+}
+
+func TestCheckEnumField(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		err  string
+	}{
+		{`<value name="banned" value="2"/>`, `<value name="banned" value="1"/>`, `field "status" duplicate enum value "1"`},
+		{`<value name="banned" value="2"/>`, `<value name="active" value="2"/>`, `field "status" duplicate enum name "active"`},
+		{`<value name="banned" value="2"/>`, `<value name="banned" value="x"/>`, `field "status" enum "banned" value "x" is not a valid int`},
+		{`<field name="status" type="enum">`, `<field name="status" type="enum" default="deleted">`, `field "status" default "deleted" is not one of the enum names`},
+		{`<field name="tags" type="array:string"/>`, `<field name="tags" type="array:string"><value name="a" value="a"/></field>`, `field "tags" values are only supported by enum and enum:string`},
+	}
+	for _, tt := range tests {
+		_, err := decodeMeta("user.xml", []byte(strings.Replace(testUserXML, tt.from, tt.to, 1)))
+		assertError(t, err, tt.err)
+	}
+}
@@ -0,0 +1,229 @@
+package meta
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// 根据文件后缀判断meta定义的格式，不支持的格式返回空字符串
+func metaFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xml":
+		return "xml"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".json":
+		return "json"
+	}
+	return ""
+}
+
+func decodeMeta(filename string, data []byte) (meta Meta, err error) {
+	switch metaFormat(filename) {
+	case "xml":
+		return validateMeta(filename, data)
+	case "yaml":
+		if err = yaml.UnmarshalStrict(data, &meta); err != nil {
+			return meta, errors.New(filename + ": " + err.Error())
+		}
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&meta); err != nil {
+			return meta, errors.New(filename + ": " + err.Error())
+		}
+	default:
+		return meta, errors.New("unsupported meta format " + filename)
+	}
+
+	if len(meta.Keys) > 0 {
+		meta.Key = meta.Keys[0]
+	}
+	verr := &validateErrors{filename: filename, data: data}
+	checkRequired(meta, verr)
+	checkMetaName(meta, metaLines{}, verr)
+	checkKeys(meta, metaLines{}, verr)
+	checkFields(meta, metaLines{}, verr)
+	checkEnumNames(meta, metaLines{}, verr)
+	return meta, verr.err()
+}
+
+func encodeMeta(format string, meta Meta) (data []byte, err error) {
+	switch format {
+	case "xml":
+		if data, err = xml.MarshalIndent(meta, "", "    "); err != nil {
+			return
+		}
+		return append([]byte(xml.Header), append(data, '\n')...), nil
+	case "yaml":
+		return yaml.Marshal(meta)
+	case "json":
+		if data, err = json.MarshalIndent(meta, "", "    "); err != nil {
+			return
+		}
+		return append(data, '\n'), nil
+	}
+	return nil, errors.New("unsupported meta format " + format)
+}
+
+// 在xml、yaml、json格式之间转换meta定义，目标格式由dst的后缀决定
+func ConvertMeta(src, dst string) error {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	meta, err := decodeMeta(src, data)
+	if err != nil {
+		return err
+	}
+	format := metaFormat(dst)
+	if format == "" {
+		return errors.New("unsupported meta format " + dst)
+	}
+	if data, err = encodeMeta(format, meta); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, data, 0644)
+}
+
+func (f MetaFields) MarshalJSON() ([]byte, error) {
+	if f.List == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(f.List)
+}
+
+func (f *MetaFields) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(&f.List)
+}
+
+func (f MetaFields) MarshalYAML() (interface{}, error) {
+	return f.List, nil
+}
+
+func (f *MetaFields) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return unmarshal(&f.List)
+}
+
+func (i MetaIndexes) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if len(i.List) == 0 {
+		return nil
+	}
+	return e.EncodeElement(struct {
+		List []MetaIndex `xml:"index"`
+	}{i.List}, start)
+}
+
+func (i MetaIndexes) MarshalJSON() ([]byte, error) {
+	if i.List == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(i.List)
+}
+
+func (i *MetaIndexes) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(&i.List)
+}
+
+func (i MetaIndexes) MarshalYAML() (interface{}, error) {
+	return i.List, nil
+}
+
+func (i *MetaIndexes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return unmarshal(&i.List)
+}
+
+func (r MetaRelations) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if len(r.List) == 0 {
+		return nil
+	}
+	return e.EncodeElement(struct {
+		List []MetaRelation `xml:"relation"`
+	}{r.List}, start)
+}
+
+func (r MetaRelations) MarshalJSON() ([]byte, error) {
+	if r.List == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(r.List)
+}
+
+func (r *MetaRelations) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(&r.List)
+}
+
+func (r MetaRelations) MarshalYAML() (interface{}, error) {
+	return r.List, nil
+}
+
+func (r *MetaRelations) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return unmarshal(&r.List)
+}
+
+func (r MetaRelations) IsZero() bool {
+	return len(r.List) == 0
+}
+
+// omitempty对结构体无效，空索引列表需要自行判断
+func (i MetaIndexes) IsZero() bool {
+	return len(i.List) == 0
+}
+
+// 单个主键写成对象，联合主键写成数组，两种写法都可以解析
+func (k MetaKeys) MarshalJSON() ([]byte, error) {
+	if len(k) == 1 {
+		return json.Marshal(k[0])
+	}
+	return json.Marshal([]MetaField(k))
+}
+
+func (k *MetaKeys) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if len(data) > 0 && data[0] == '[' {
+		return decoder.Decode((*[]MetaField)(k))
+	}
+	var key MetaField
+	if err := decoder.Decode(&key); err != nil {
+		return err
+	}
+	*k = MetaKeys{key}
+	return nil
+}
+
+func (k MetaKeys) MarshalYAML() (interface{}, error) {
+	if len(k) == 1 {
+		return k[0], nil
+	}
+	return []MetaField(k), nil
+}
+
+func (k *MetaKeys) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw interface{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	if _, ok := raw.([]interface{}); ok {
+		return unmarshal((*[]MetaField)(k))
+	}
+	var key MetaField
+	if err := unmarshal(&key); err != nil {
+		return err
+	}
+	*k = MetaKeys{key}
+	return nil
+}
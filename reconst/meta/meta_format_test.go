@@ -0,0 +1,82 @@
+package meta
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestConvertMetaRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reconst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(dir+"/user.xml", []byte(testUserXML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want, err := decodeMeta("user.xml", []byte(testUserXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJSON, err := encodeMeta("json", want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dst := range []string{"user.yaml", "user.json"} {
+		if err = ConvertMeta(dir+"/user.xml", dir+"/"+dst); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(dir + "/" + dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := decodeMeta(dst, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// nil和空切片在不同格式中无法区分，按编码后的结果比较
+		gotJSON, err := encodeMeta("json", got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(gotJSON) != string(wantJSON) {
+			t.Errorf("%s decodes to\n%s\nwant\n%s", dst, gotJSON, wantJSON)
+		}
+	}
+}
+
+func TestDecodeMetaStrictFormats(t *testing.T) {
+	yamlSrc := `module: shop
+name: item
+key: {name: id, type: auto}
+fields:
+  - {name: title, type: string, colour: red}
+strategy:
+  storage: {type: mysql, database: shop, table: item}
+`
+	_, err := decodeMeta("item.yaml", []byte(yamlSrc))
+	assertError(t, err, "colour")
+
+	jsonSrc := `{"module": "shop", "name": "item", "key": {"name": "id", "type": "auto"},
+"fields": [{"name": "title", "type": "string"}], "strategy": {"storage": {"type": "mysql", "database": "shop"}}}`
+	_, err = decodeMeta("item.json", []byte(jsonSrc))
+	assertError(t, err, `missing required "strategy.storage.table"`)
+
+	_, err = decodeMeta("item.toml", nil)
+	assertError(t, err, "unsupported meta format item.toml")
+}
+
+func TestGenerateFromYAML(t *testing.T) {
+	yamlSrc := `module: shop
+name: item
+key: {name: id, type: auto}
+fields:
+  - {name: title, type: string}
+strategy:
+  storage: {type: mysql, database: shop, table: item}
+`
+	sources := mustGenerate(t, map[string]string{"item.yaml": yamlSrc})
+	assertDecls(t, sources, "shop_item.go", "MetaShopItem", "ShopItem", "queryShopItem.WhereTitleEqual")
+}
@@ -0,0 +1,146 @@
+package meta
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+
+	"github.com/leochen2038/goplay/reconst/env"
+)
+
+// play v0.4.5之后才加入框架的接口，驱动函数的值为参数个数，play.Query.Tx为查询的字段。
+// 生成的代码只使用项目依赖的框架中存在的接口：缺少接口时不生成依赖它的方法，meta中显式声明的功能报错
+var frameworkAPIs = map[string]int{
+	"play.Query.Tx":      0,
+	"mysql.Begin":        1,
+	"mysql.SaveMany":     2,
+	"mysql.Upsert":       4,
+	"mysql.UpdateMany":   2,
+	"mysql.Aggregate":    4,
+	"mysql.GroupCount":   3,
+	"mongodb.SaveMany":   2,
+	"mongodb.Upsert":     4,
+	"mongodb.UpdateMany": 2,
+	"mongodb.Aggregate":  4,
+	"mongodb.GroupCount": 3,
+}
+
+// play v0.4.5之后驱动才支持的查询条件，v0.4.5只支持Equal、NotEqual、Less、Greater、Like、Between、In、NotIn。
+// 驱动按play.Condition.Con的取值分支处理，Raw只用于mysql
+var frameworkConditions = []string{"LessOrEqual", "GreaterOrEqual", "NotLike", "NotBetween", "IsNull", "IsNotNull", "Group", "Raw"}
+
+// FrameworkAPIs 项目依赖的框架中存在的frameworkAPIs，驱动支持的条件记为<驱动>.Condition.<Con>，由LoadFrameworkAPIs设置，为空时只使用v0.4.5的接口
+var FrameworkAPIs = map[string]bool{}
+
+// LoadFrameworkAPIs 解析dir中的框架源码设置FrameworkAPIs，返回框架缺少的接口
+func LoadFrameworkAPIs(dir string) (missing []string) {
+	declared := map[string]int{}
+	parseFrameworkPackage(dir, func(decl ast.Decl) {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.TYPE {
+			for _, spec := range d.Specs {
+				if s, ok := spec.(*ast.TypeSpec); ok && s.Name.Name == "Query" {
+					if st, ok := s.Type.(*ast.StructType); ok {
+						for _, field := range st.Fields.List {
+							for _, name := range field.Names {
+								declared["play.Query."+name.Name] = 0
+							}
+						}
+					}
+				}
+			}
+		}
+	})
+	conditions := map[string]bool{}
+	for _, pkg := range []string{"mysql", "mongodb"} {
+		parseFrameworkPackage(dir+"/database/"+pkg, func(decl ast.Decl) {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil {
+				declared[pkg+"."+fn.Name.Name] = fn.Type.Params.NumFields()
+			}
+			// 条件出现在switch的case或map的键中
+			ast.Inspect(decl, func(n ast.Node) bool {
+				var exprs []ast.Expr
+				switch node := n.(type) {
+				case *ast.CaseClause:
+					exprs = node.List
+				case *ast.KeyValueExpr:
+					exprs = []ast.Expr{node.Key}
+				}
+				for _, expr := range exprs {
+					if lit, ok := expr.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+						if con, err := strconv.Unquote(lit.Value); err == nil {
+							conditions[pkg+".Condition."+con] = true
+						}
+					}
+				}
+				return true
+			})
+		})
+	}
+
+	FrameworkAPIs = map[string]bool{}
+	for name, params := range frameworkAPIs {
+		if n, ok := declared[name]; ok && n == params {
+			FrameworkAPIs[name] = true
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	for _, pkg := range []string{"mysql", "mongodb"} {
+		for _, con := range frameworkConditions {
+			if name := pkg + ".Condition." + con; conditions[name] {
+				FrameworkAPIs[name] = true
+			} else if pkg == "mysql" || con != "Raw" {
+				missing = append(missing, name)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return
+}
+
+func parseFrameworkPackage(dir string, fn func(decl ast.Decl)) {
+	pkgs, _ := parser.ParseDir(token.NewFileSet(), dir, nil, 0)
+	for _, p := range pkgs {
+		for _, file := range p.Files {
+			for _, decl := range file.Decls {
+				fn(decl)
+			}
+		}
+	}
+}
+
+// meta的驱动是否提供name函数
+func hasDriveAPI(meta Meta, name string) bool {
+	return FrameworkAPIs[meta.Strategy.Storage.Type+"."+name]
+}
+
+// meta的驱动是否支持查询条件con，v0.4.5已有的条件总是支持
+func hasCondition(meta Meta, con string) bool {
+	return !inStrings(frameworkConditions, con) || FrameworkAPIs[meta.Strategy.Storage.Type+".Condition."+con]
+}
+
+// 事务通过play.Query.Tx传给驱动，mysql的事务由library/db中的Tx通过mysql.Begin开启
+func hasTx(meta Meta) bool {
+	if meta.Strategy.Storage.Type == "mongodb" {
+		return FrameworkAPIs["play.Query.Tx"]
+	}
+	return hasMysqlTx()
+}
+
+func hasMysqlTx() bool {
+	return FrameworkAPIs["play.Query.Tx"] && FrameworkAPIs["mysql.Begin"]
+}
+
+// storage设置tx="true"的meta依赖事务，与索引一样，框架没有提供时报错而不是静默地不生成WithTx
+func checkTx(meta Meta) error {
+	if !meta.Strategy.Storage.Tx || hasTx(meta) {
+		return nil
+	}
+	if meta.Strategy.Storage.Type == "mongodb" {
+		return errors.New("tx requires play.Query.Tx, which is not provided by " + env.FrameworkName)
+	}
+	return errors.New("tx requires play.Query.Tx and mysql.Begin, which are not provided by " + env.FrameworkName)
+}
@@ -5,23 +5,27 @@ import (
 	"errors"
 	"fmt"
 	"github.com/leochen2038/goplay/reconst/env"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"runtime"
 	"strings"
 	"unicode"
 )
 
 type Meta struct {
-	XMLName  xml.Name     `xml:"meta"`
-	Module   string       `xml:"module,attr"`
-	Name     string       `xml:"name,attr"`
-	Tag      string       `xml:"tag,attr"`
-	Key      MetaField    `xml:"key"`
-	Fields   MetaFields   `xml:"fields"`
-	Strategy MetaStrategy `xml:"strategy"`
+	XMLName   xml.Name      `xml:"meta" json:"-" yaml:"-"`
+	Module    string        `xml:"module,attr" json:"module" yaml:"module"`
+	Name      string        `xml:"name,attr" json:"name" yaml:"name"`
+	Tag       string        `xml:"tag,attr,omitempty" json:"tag,omitempty" yaml:"tag,omitempty"`
+	Package   string        `xml:"package,attr,omitempty" json:"package,omitempty" yaml:"package,omitempty"`
+	Key       MetaField     `xml:"-" json:"-" yaml:"-"`
+	Keys      MetaKeys      `xml:"key" json:"key" yaml:"key"`
+	Fields    MetaFields    `xml:"fields" json:"fields" yaml:"fields"`
+	Strategy  MetaStrategy  `xml:"strategy" json:"strategy" yaml:"strategy"`
+	Relations MetaRelations `xml:"relations" json:"relations" yaml:"relations,omitempty"`
 }
 
 type MetaFields struct {
@@ -29,44 +33,154 @@ type MetaFields struct {
 }
 
 type MetaField struct {
-	Name    string `xml:"name,attr"`
-	Alias   string `xml:"alias,attr"`
-	Type    string `xml:"type,attr"`
-	Note    string `xml:"note,attr"`
-	Default string `xml:"default,attr"`
-}
+	Name     string `xml:"name,attr" json:"name" yaml:"name"`
+	Alias    string `xml:"alias,attr,omitempty" json:"alias,omitempty" yaml:"alias,omitempty"`
+	Type     string `xml:"type,attr" json:"type" yaml:"type"`
+	Note     string `xml:"note,attr,omitempty" json:"note,omitempty" yaml:"note,omitempty"`
+	Default  string `xml:"default,attr,omitempty" json:"default,omitempty" yaml:"default,omitempty"`
+	Unit     string `xml:"unit,attr,omitempty" json:"unit,omitempty" yaml:"unit,omitempty"`
+	Version  bool   `xml:"version,attr,omitempty" json:"version,omitempty" yaml:"version,omitempty"`
+	Generate string `xml:"generate,attr,omitempty" json:"generate,omitempty" yaml:"generate,omitempty"`
+
+	// 校验规则，由Validate方法检查
+	Required bool   `xml:"required,attr,omitempty" json:"required,omitempty" yaml:"required,omitempty"`
+	Min      string `xml:"min,attr,omitempty" json:"min,omitempty" yaml:"min,omitempty"`
+	Max      string `xml:"max,attr,omitempty" json:"max,omitempty" yaml:"max,omitempty"`
+	MinLen   int    `xml:"minlen,attr,omitempty" json:"minlen,omitempty" yaml:"minlen,omitempty"`
+	MaxLen   int    `xml:"maxlen,attr,omitempty" json:"maxlen,omitempty" yaml:"maxlen,omitempty"`
+	Pattern  string `xml:"pattern,attr,omitempty" json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	Format   string `xml:"format,attr,omitempty" json:"format,omitempty" yaml:"format,omitempty"`
+	OneOf    string `xml:"oneof,attr,omitempty" json:"oneof,omitempty" yaml:"oneof,omitempty"`
+
+	// object、array:object、map:object类型的子字段
+	Fields []MetaField `xml:"field" json:"fields,omitempty" yaml:"fields,omitempty"`
+	// enum、enum:string类型允许的取值
+	Values []MetaEnumValue `xml:"value" json:"values,omitempty" yaml:"values,omitempty"`
+
+	structName string
+	goType     string
+}
+
+// 多个<key>组成联合主键，Key为第一个主键
+type MetaKeys []MetaField
 
 type MetaStrategy struct {
-	Storage MetaStorage `xml:"storage"`
+	Storage MetaStorage `xml:"storage" json:"storage" yaml:"storage"`
+	Indexes MetaIndexes `xml:"indexes" json:"indexes" yaml:"indexes,omitempty"`
+	Cache   *MetaCache  `xml:"cache" json:"cache,omitempty" yaml:"cache,omitempty"`
 }
 
 type MetaStorage struct {
-	Type     string `xml:"type,attr"`
-	Drive    string `xml:"drive,attr"`
-	Database string `xml:"database,attr"`
-	Table    string `xml:"table,attr"`
-	Router   string `xml:"router,attr"`
+	Type     string `xml:"type,attr" json:"type" yaml:"type"`
+	Drive    string `xml:"drive,attr,omitempty" json:"drive,omitempty" yaml:"drive,omitempty"`
+	Database string `xml:"database,attr" json:"database" yaml:"database"`
+	Table    string `xml:"table,attr" json:"table" yaml:"table"`
+	Router   string `xml:"router,attr,omitempty" json:"router,omitempty" yaml:"router,omitempty"`
+	// Route 分片和读写路由规则，见metaRoute
+	Route string `xml:"route,attr,omitempty" json:"route,omitempty" yaml:"route,omitempty"`
+	// Validator 为true时为mongodb集合生成$jsonSchema校验
+	Validator bool `xml:"validator,attr,omitempty" json:"validator,omitempty" yaml:"validator,omitempty"`
+	// Tx 为true时必须生成WithTx，框架不支持事务时报错，不设置时按框架是否支持生成
+	Tx bool `xml:"tx,attr,omitempty" json:"tx,omitempty" yaml:"tx,omitempty"`
+}
+
+type MetaCache struct {
+	Type string `xml:"type,attr" json:"type" yaml:"type"`
+	TTL  int    `xml:"ttl,attr,omitempty" json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	Size int    `xml:"size,attr,omitempty" json:"size,omitempty" yaml:"size,omitempty"`
+	Keys string `xml:"keys,attr,omitempty" json:"keys,omitempty" yaml:"keys,omitempty"`
+}
+
+type MetaIndexes struct {
+	List []MetaIndex `xml:"index"`
+}
+
+type MetaIndex struct {
+	Name   string `xml:"name,attr,omitempty" json:"name,omitempty" yaml:"name,omitempty"`
+	Fields string `xml:"fields,attr" json:"fields" yaml:"fields"`
+	Unique bool   `xml:"unique,attr,omitempty" json:"unique,omitempty" yaml:"unique,omitempty"`
+	TTL    int32  `xml:"ttl,attr,omitempty" json:"ttl,omitempty" yaml:"ttl,omitempty"`
 }
 
+type MetaRelations struct {
+	List []MetaRelation `xml:"relation"`
+}
+
+type MetaRelation struct {
+	Name    string `xml:"name,attr" json:"name" yaml:"name"`
+	Type    string `xml:"type,attr" json:"type" yaml:"type"`
+	Module  string `xml:"module,attr" json:"module" yaml:"module"`
+	Meta    string `xml:"meta,attr" json:"meta" yaml:"meta"`
+	Foreign string `xml:"foreign,attr" json:"foreign" yaml:"foreign"`
+}
+
+// 本次生成涉及的所有meta，以module.name为键，用于解析meta之间的关联
+var metas = map[string]Meta{}
+
 func MetaGenerator() error {
-	return filepath.Walk(env.ProjectPath+"/assets/meta", func(filename string, fi os.FileInfo, err error) error {
+	// 同一进程中多次生成时重新收集，上一次的meta和声明不会造成冲突
+	metas = map[string]Meta{}
+	packageFiles, packageDecls = map[string]map[string]string{}, map[string]map[string]string{}
+
+	// 先加载全部meta，生成时才能解析跨meta的关联
+	var filenames []string
+	var list []Meta
+	err := filepath.Walk(env.ProjectPath+"/assets/meta", func(filename string, fi os.FileInfo, err error) error {
 		var data []byte
 		var meta Meta
 
-		if fi != nil && !fi.IsDir() && strings.HasSuffix(filename, ".xml") {
+		if fi != nil && !fi.IsDir() && metaFormat(filename) != "" {
 			if data, err = ioutil.ReadFile(filename); err != nil {
 				return err
 			}
-			if err = xml.Unmarshal(data, &meta); err != nil {
-				return errors.New("check: " + filename + " failure:" + err.Error())
+			if meta, err = decodeMeta(filename, data); err != nil {
+				return errors.New("check: " + filename + " failure:\n" + err.Error())
 			}
-			if err = writeMeta(meta); err != nil {
-				return errors.New("check: " + filename + " failure: " + err.Error())
+			metaKey := meta.Module + "." + meta.Name
+			if _, ok := metas[metaKey]; ok {
+				return errors.New("check: " + filename + " failure: duplicate meta " + metaKey)
 			}
-			fmt.Println("check:", filename, "success")
+			metas[metaKey] = meta
+			filenames = append(filenames, filename)
+			list = append(list, meta)
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	// library/db始终生成common.go，其他包在有meta时生成
+	packages := []string{"db"}
+	for _, meta := range list {
+		if !inStrings(packages, metaPackage(meta)) {
+			packages = append(packages, metaPackage(meta))
+		}
+	}
+	sharedMongo := false
+	for _, meta := range list {
+		sharedMongo = sharedMongo || meta.Strategy.Storage.Type == "mongodb"
+	}
+	for _, pkg := range packages {
+		mongo := false
+		for _, meta := range list {
+			mongo = mongo || metaPackage(meta) == pkg && meta.Strategy.Storage.Type == "mongodb"
+		}
+		if err = writeCommon(pkg, mongo, sharedMongo); err != nil {
+			return err
+		}
+	}
+
+	for i, meta := range list {
+		if err = writeMeta(meta); err != nil {
+			return errors.New("check: " + filenames[i] + " failure: " + err.Error())
+		}
+		fmt.Println("check:", filenames[i], "success")
+	}
+	if err = writePackageIndexes(list); err != nil {
+		return err
+	}
+	return removeStaleSources()
 }
 
 func formatLowerName(name string) string {
@@ -83,34 +197,21 @@ func formatUcfirstName(name string) string {
 
 func generateCode(meta Meta) string {
 	whereOr := map[string]string{"Where": "true", "Or": "false"}
-	con1List := [...]string{"Equal", "NotEqual", "Less", "Greater", "Like"}
-	con2List := [...]string{"Between"}
+	con0List := [...]string{"IsNull", "IsNotNull"}
+	con1List := [...]string{"Equal", "NotEqual", "Less", "LessOrEqual", "Greater", "GreaterOrEqual", "Like", "NotLike"}
+	con2List := [...]string{"Between", "NotBetween"}
 	conslice := [...]string{"In", "NotIn"}
 
 	funcName := formatUcfirstName(meta.Module) + formatUcfirstName(meta.Name)
-	src := "package db\n"
+	var driveImport string
 	if meta.Strategy.Storage.Type == "mongodb" {
 		if meta.Strategy.Storage.Drive == "" || meta.Strategy.Storage.Drive == "default" {
 			meta.Strategy.Storage.Drive = "mongodb"
 		}
 		if meta.Strategy.Storage.Drive == "mongodb" {
-			src += fmt.Sprintf(`
-import (
-	"%s"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"%s/database/mongodb"
-	"time"
-)
-`, env.FrameworkName, env.FrameworkName)
+			driveImport = fmt.Sprintf(`"%s/database/mongodb"`, env.FrameworkName)
 		} else {
-			src += fmt.Sprintf(`
-import (
-	"%s"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	mongodb "%s"
-	"time"
-)
-`, env.FrameworkName, meta.Strategy.Storage.Drive)
+			driveImport = fmt.Sprintf(`mongodb "%s"`, meta.Strategy.Storage.Drive)
 			meta.Strategy.Storage.Drive = "mongodb"
 		}
 	} else {
@@ -118,45 +219,45 @@ import (
 			meta.Strategy.Storage.Drive = "mysql"
 		}
 		if meta.Strategy.Storage.Drive == "mysql" {
-			src += fmt.Sprintf(`
-import (
-	"%s"
-	"%s/database/mysql"
-)
-`, env.FrameworkName, env.FrameworkName)
+			driveImport = fmt.Sprintf(`"%s/database/mysql"`, env.FrameworkName)
 		} else {
-			src += fmt.Sprintf(`
-import (
-	"%s"
-	mysql "%s"
-)
-`, env.FrameworkName, meta.Strategy.Storage.Drive)
+			driveImport = fmt.Sprintf(`mysql "%s"`, meta.Strategy.Storage.Drive)
 			meta.Strategy.Storage.Drive = "mysql"
 		}
 	}
 
-	src += genSubObject(meta, funcName)
+	// 查询通过store变量执行，驱动只在默认的store实现中调用
+	drive := meta.Strategy.Storage.Drive
+	meta.Strategy.Storage.Drive = storeVarName(funcName)
+
+	meta.Fields.List = prepareObjectFields(meta.Fields.List, "Meta"+funcName, meta.Strategy.Storage.Type != "mongodb")
+	meta.Fields.List = prepareEnumFields(meta.Fields.List, funcName)
+	if meta.Strategy.Storage.Type == "mongodb" {
+		meta.Fields.List = prepareJSONFields(meta.Fields.List)
+	}
+
+	src := ""
+	src += genObjectTypes(meta.Fields.List, meta.Strategy.Storage.Type == "mongodb", true)
+	src += genEnumCode(meta, funcName)
+	src += genValidateCode(meta, funcName)
 	src += fmt.Sprintf("\ntype Meta%s struct {\n", funcName)
-	src += "\t" + formatUcfirstName(meta.Key.Name) + " "
 	if meta.Strategy.Storage.Type == "mongodb" {
-		src += "primitive.ObjectID\t `bson:\"" + meta.Key.Name + "\""
+		src += "\t" + formatUcfirstName(meta.Key.Name) + " primitive.ObjectID\t `bson:\"" + meta.Key.Name + "\""
 		if meta.Key.Alias != "" {
 			src += ` json:"` + meta.Key.Alias + `"`
 		}
 		src += "`\n"
 	} else {
-		if meta.Key.Type == "auto" {
-			src += "int\t `db:\"" + meta.Key.Name + "\""
-		} else {
-			src += meta.Key.Type + "\t `db:\"" + meta.Key.Name + "\""
-		}
-		if meta.Key.Alias != "" {
-			src += ` json:"` + meta.Key.Alias + `"`
+		for _, key := range meta.Keys {
+			src += "\t" + formatUcfirstName(key.Name) + " " + getKeyFieldGolangType(meta, key) + "\t `db:\"" + key.Name + "\""
+			if key.Alias != "" {
+				src += ` json:"` + key.Alias + `"`
+			}
+			src += "`\n"
 		}
-		src += "`\n"
 	}
 	for _, vb := range meta.Fields.List {
-		src += "\t" + ucfirst(vb.Name) + " " + getGolangType(vb.Type)
+		src += "\t" + ucfirst(vb.Name) + " " + getFieldGolangType(vb)
 		if meta.Strategy.Storage.Type == "mongodb" {
 			src += "\t `bson:\"" + vb.Name + "\""
 			if vb.Alias != "" {
@@ -171,6 +272,7 @@ import (
 			src += "`\n"
 		}
 	}
+	src += genRelationFields(meta)
 	src += "}\n"
 
 	for _, vb := range meta.Fields.List {
@@ -178,21 +280,28 @@ import (
 	meta.%s = val
 	return meta
 }
-`, funcName, ucfirst(vb.Name), getGolangType(vb.Type), funcName, ucfirst(vb.Name))
+`, funcName, ucfirst(vb.Name), getFieldGolangType(vb), funcName, ucfirst(vb.Name))
 	}
+	src += genFieldValueCode(meta, funcName)
+	src += genStoreCode(meta, funcName, drive)
 	src += "\n"
 
-	src += fmt.Sprintf(`
-type query%s struct {
-	query play.Query
-}
-`, funcName)
+	src += fmt.Sprintf("\ntype query%s struct {\n\tquery play.Query\n\terr   error\n", funcName)
+	if _, ok := getSoftDeleteField(meta); ok {
+		src += "\ttrashed int\n"
+	}
+	src += genRelationQueryFields(meta)
+	src += "}\n"
 
-	var initFields string
+	var initFields, keyFields, keepKeys []string
 	for _, field := range meta.Fields.List {
-		initFields += fmt.Sprintf(`"%s":true,`, field.Name)
+		initFields = append(initFields, fmt.Sprintf(`"%s":true`, field.Name))
+	}
+	for _, key := range meta.Keys {
+		initFields = append(initFields, fmt.Sprintf(`"%s":true`, key.Name))
+		keyFields = append(keyFields, fmt.Sprintf(`"%s":true`, key.Name))
+		keepKeys = append(keepKeys, fmt.Sprintf(`q.query.Fields["%s"] = true`, key.Name))
 	}
-	initFields += fmt.Sprintf(`"%s":true`, meta.Key.Name)
 
 	src += fmt.Sprintf(`
 func %s() *query%s {
@@ -206,65 +315,130 @@ func %s() *query%s {
 	obj.query.Fields = map[string]bool{%s}
 	return obj
 }
-`, funcName, funcName, funcName, meta.Module, meta.Name, meta.Strategy.Storage.Database, meta.Strategy.Storage.Table, meta.Strategy.Storage.Router, initFields)
+`, funcName, funcName, funcName, meta.Module, meta.Name, meta.Strategy.Storage.Database, meta.Strategy.Storage.Table, getDefaultRouter(meta), strings.Join(initFields, ","))
+
+	src += genFieldConsts(meta, funcName)
+	src += fmt.Sprintf(`
+// Select 只查询指定的字段，主键总是会被查询
+func (q *query%s)Select(fields ...%sField) *query%s {
+	q.query.Fields = map[string]bool{%s}
+	for _, field := range fields {
+		q.query.Fields[string(field)] = true
+	}
+	return q
+}
+
+// Omit 从查询字段中排除指定的字段，与Select一样主键总是会被查询，分批遍历和关联加载依赖主键
+func (q *query%s)Omit(fields ...%sField) *query%s {
+	for _, field := range fields {
+		delete(q.query.Fields, string(field))
+	}
+	%s
+	return q
+}
+`, funcName, funcName, funcName, strings.Join(keyFields, ","), funcName, funcName, funcName, strings.Join(keepKeys, "\n\t"))
+
+	for _, cond := range con0List {
+		if !hasCondition(meta, cond) {
+			continue
+		}
+		// generate key
+		for _, key := range meta.Keys {
+			for where, wherebool := range whereOr {
+				src += fmt.Sprintf(`
+func (q *query%s)%s%s%s() *query%s {
+	q.query.Conditions = append(q.query.Conditions, play.Condition{AndOr:%s, Field:"%s", Con:"%s"})
+	return q
+}
+`, funcName, where, formatUcfirstName(key.Name), cond, funcName, wherebool, key.Name, cond)
+			}
+		}
+
+		// generate fields
+		for _, vb := range meta.Fields.List {
+			for where, wherebool := range whereOr {
+				src += fmt.Sprintf(`
+func (q *query%s)%s%s%s() *query%s {
+	q.query.Conditions = append(q.query.Conditions, play.Condition{AndOr:%s, Field:"%s", Con:"%s"})
+	return q
+}
+`, funcName, where, ucfirst(vb.Name), cond, funcName, wherebool, vb.Name, cond)
+			}
+		}
+	}
 
 	for _, cond := range con1List {
+		if !hasCondition(meta, cond) {
+			continue
+		}
 		// generate key
-		for where, wherebool := range whereOr {
-			src += fmt.Sprintf(`
-func (q *query%s)%s%s%s(val interface{}) *query%s {
+		for _, key := range meta.Keys {
+			keyType := getKeyFieldGolangType(meta, key)
+			for where, wherebool := range whereOr {
+				src += fmt.Sprintf(`
+func (q *query%s)%s%s%s(val %s) *query%s {
 	q.query.Conditions = append(q.query.Conditions, play.Condition{AndOr:%s, Field:"%s", Con:"%s", Val:val})
 	return q
 }
-`, funcName, where, formatUcfirstName(meta.Key.Name), cond, funcName, wherebool, meta.Key.Name, cond)
+`, funcName, where, formatUcfirstName(key.Name), cond, getCondGolangType(cond, keyType), funcName, wherebool, key.Name, cond)
+			}
 		}
 
 		// generate fields
 		for _, vb := range meta.Fields.List {
 			for where, wherebool := range whereOr {
 				src += fmt.Sprintf(`
-func (q *query%s)%s%s%s(val interface{}) *query%s {
+func (q *query%s)%s%s%s(val %s) *query%s {
 	q.query.Conditions = append(q.query.Conditions, play.Condition{AndOr:%s, Field:"%s", Con:"%s", Val:val})
 	return q
 }
-`, funcName, where, ucfirst(vb.Name), cond, funcName, wherebool, vb.Name, cond)
+`, funcName, where, ucfirst(vb.Name), cond, getCondGolangType(cond, getFieldGolangType(vb)), funcName, wherebool, vb.Name, cond)
 			}
 		}
 	}
 
 	for _, cond := range con2List {
+		if !hasCondition(meta, cond) {
+			continue
+		}
 		// generate key
-		for where, wherebool := range whereOr {
-			src += fmt.Sprintf(`
-func (q *query%s)%s%s%s(v1 interface{}, v2 interface{}) *query%s {
+		for _, key := range meta.Keys {
+			keyType := getKeyFieldGolangType(meta, key)
+			for where, wherebool := range whereOr {
+				src += fmt.Sprintf(`
+func (q *query%s)%s%s%s(v1 %s, v2 %s) *query%s {
 	q.query.Conditions = append(q.query.Conditions, play.Condition{AndOr:%s, Field:"%s", Con:"%s", Val:[2]interface{}{v1, v2}})
 	return q
 }
-`, funcName, where, formatUcfirstName(meta.Key.Name), cond, funcName, wherebool, meta.Key.Name, cond)
+`, funcName, where, formatUcfirstName(key.Name), cond, keyType, keyType, funcName, wherebool, key.Name, cond)
+			}
 		}
 
 		// generate fields
 		for _, vb := range meta.Fields.List {
 			for where, wherebool := range whereOr {
 				src += fmt.Sprintf(`
-func (q *query%s)%s%s%s(v1 interface{}, v2 interface{}) *query%s {
+func (q *query%s)%s%s%s(v1 %s, v2 %s) *query%s {
 	q.query.Conditions = append(q.query.Conditions, play.Condition{AndOr:%s, Field:"%s", Con:"%s", Val:[2]interface{}{v1, v2}})
 	return q
 }
-`, funcName, where, ucfirst(vb.Name), cond, funcName, wherebool, vb.Name, cond)
+`, funcName, where, ucfirst(vb.Name), cond, getFieldGolangType(vb), getFieldGolangType(vb), funcName, wherebool, vb.Name, cond)
 			}
 		}
 	}
 
 	for _, cond := range conslice {
 		// generate key
-		for where, wherebool := range whereOr {
-			src += fmt.Sprintf(`
-func (q *query%s)%s%s%s(s []interface{}) *query%s {
+		for _, key := range meta.Keys {
+			keyType := getKeyFieldGolangType(meta, key)
+			for where, wherebool := range whereOr {
+				src += fmt.Sprintf(`
+func (q *query%s)%s%s%s(s []%s) *query%s {
 	q.query.Conditions = append(q.query.Conditions, play.Condition{AndOr:%s, Field:"%s", Con:"%s", Val:s})
 	return q
 }
-`, funcName, where, formatUcfirstName(meta.Key.Name), cond, funcName, wherebool, meta.Key.Name, cond)
+`, funcName, where, formatUcfirstName(key.Name), cond, keyType, funcName, wherebool, key.Name, cond)
+			}
 		}
 
 		// generate fields
@@ -275,11 +449,44 @@ func (q *query%s)%s%s%s(s []%s) *query%s {
 	q.query.Conditions = append(q.query.Conditions, play.Condition{AndOr:%s, Field:"%s", Con:"%s", Val:s})
 	return q
 }
-`, funcName, where, ucfirst(vb.Name), cond, getGolangType(vb.Type), funcName, wherebool, vb.Name, cond)
+`, funcName, where, ucfirst(vb.Name), cond, getFieldGolangType(vb), funcName, wherebool, vb.Name, cond)
 			}
 		}
 	}
 
+	// 括号分组条件，分组内的条件由fn添加，驱动不支持时不生成
+	if hasCondition(meta, "Group") {
+		for where, wherebool := range whereOr {
+			src += fmt.Sprintf(`
+func (q *query%s)%sGroup(fn func(g *query%s)) *query%s {
+	g := &query%s{}
+	fn(g)
+	if g.err != nil {
+		q.err = g.err
+	}
+	q.query.Conditions = append(q.query.Conditions, play.Condition{AndOr:%s, Con:"Group", Val:g.query.Conditions})
+	return q
+}
+`, funcName, where, funcName, funcName, funcName, wherebool)
+		}
+	}
+
+	// 原生sql表达式，值必须以?占位符的方式传入
+	if meta.Strategy.Storage.Type == "mysql" && hasCondition(meta, "Raw") {
+		for where, wherebool := range whereOr {
+			src += fmt.Sprintf(`
+func (q *query%s)%sRaw(expr string, args ...interface{}) *query%s {
+	if err := checkRawExpr(expr, args); err != nil {
+		q.err = err
+		return q
+	}
+	q.query.Conditions = append(q.query.Conditions, play.Condition{AndOr:%s, Field:expr, Con:"Raw", Val:args})
+	return q
+}
+`, funcName, where, funcName, wherebool)
+		}
+	}
+
 	src += fmt.Sprintf(`
 func (q *query%s)OrderBy(key, val string) *query%s {
 	q.query.Order = append(q.query.Order, [2]string{key, val})
@@ -295,15 +502,15 @@ func (q *query%s)GroupBy(key string) *query%s {
 `, funcName, funcName)
 	src += fmt.Sprintf(`
 func (q *query%s)Count() (int64, error) {
-	return %s.Count(&q.query)
+	if q.check(true) != nil {
+		return 0, q.err
+	}
+	return %s.Count(q.scope())
 }
 `, funcName, meta.Strategy.Storage.Drive)
 
-	src += fmt.Sprintf(`
-func (q *query%s)Delete() (int64, error) {
-	return %s.Delete(&q.query)
-}
-`, funcName, meta.Strategy.Storage.Drive)
+	src += genScopeCode(meta, funcName)
+	src += genDeleteCode(meta, funcName)
 
 	src += fmt.Sprintf(`
 func (q *query%s)Limit(start int64, count int64) *query%s {
@@ -316,81 +523,104 @@ func (q *query%s)Limit(start int64, count int64) *query%s {
 	if meta.Strategy.Storage.Type == "mongodb" {
 		src += fmt.Sprintf(`
 func (q *query%s)UpdateAndGetOne() (*Meta%s, error) {
+	if q.check(false) != nil {
+		return nil, q.err
+	}
+	query := q.updateScope()
+	%s
+	%s
 	meta := &Meta%s{}
-	if err := %s.UpdateAndGetOne(meta, &q.query); err != nil {
+	if err := %s.UpdateAndGetOne(meta, query); err != nil {
 		return nil, err 
 	}
+	if err := afterFind(meta); err != nil {
+		return nil, err
+	}
 	return meta, nil
 }
-`, funcName, funcName, funcName, meta.Strategy.Storage.Drive)
+`, funcName, funcName, genUpdateTouchCode(meta), genCacheInvalidateCode(meta), funcName, meta.Strategy.Storage.Drive)
 	}
 
-	if meta.Strategy.Storage.Type == "mongodb" {
-		src += fmt.Sprintf(`
+	src += fmt.Sprintf(`
 func (q *query%s)GetOne() (*Meta%s, error) {
-	meta := &Meta%s{}
-	if err := %s.GetOne(meta, &q.query); err != nil {
-		return nil, err 
+	if q.check(true) != nil {
+		return nil, q.err
 	}
-	return meta, nil
-}
-`, funcName, funcName, funcName, meta.Strategy.Storage.Drive)
-	} else {
-		src += fmt.Sprintf(`
-func (q *query%s)GetOne() (*Meta%s, error) {
 	meta := &Meta%s{}
-	if err := %s.GetOne(meta, &q.query); err != nil {
+	if err := %s; err != nil {
 		return nil, err 
 	}
+	%s
+	if err := afterFind(meta); err != nil {
+		return nil, err
+	}
 	return meta, nil
 }
-`, funcName, funcName, funcName, meta.Strategy.Storage.Drive)
-	}
+`, funcName, funcName, funcName, genCacheReadCode(meta, "one", "meta", meta.Strategy.Storage.Drive+".GetOne(meta, q.scope())"), genRelationLoadCode(meta, funcName, false))
 
 	src += fmt.Sprintf(`
 func (q *query%s)GetList() ([]Meta%s, error) {
+	if q.check(true) != nil {
+		return nil, q.err
+	}
 	list := []Meta%s{}
-	err := %s.GetList(&list, &q.query)
+	err := %s
+	%s
+	for i := 0; err == nil && i < len(list); i++ {
+		err = afterFind(&list[i])
+	}
 	return list, err
 }
-`, funcName, funcName, funcName, meta.Strategy.Storage.Drive)
+`, funcName, funcName, funcName, genCacheReadCode(meta, "list", "&list", meta.Strategy.Storage.Drive+".GetList(&list, q.scope())"), genRelationLoadCode(meta, funcName, true))
 
-	if meta.Strategy.Storage.Type == "mongodb" {
-		var msrc, csrc string
-		if mtimeField, err := getSpTTime(meta.Fields, "mtime"); err == nil {
-			msrc = "meta." + ucfirst(mtimeField.Name) + " = time.Now().Unix()"
-		}
-		if ctimeField, err := getSpTTime(meta.Fields, "ctime"); err == nil {
-			csrc = "meta." + ucfirst(ctimeField.Name) + " = time.Now().Unix()"
-		}
+	src += genGetByKeyCode(meta, funcName)
+	src += genRouteCode(meta, funcName)
+	src += genRelationCode(meta, funcName)
+	src += genAggregateCode(meta, funcName)
 
-		src += fmt.Sprintf(`
-func (q *query%s)Save(meta *Meta%s) error {
-	%s
-	if meta.Id != primitive.NilObjectID {
-		return %s.Save(meta, &meta.Id, &q.query)
+	if !isCompositeKey(meta) {
+		src += genIterateCode(meta, funcName)
 	}
+	src += genBatchCode(meta, funcName)
+	src += genHookCode(meta, funcName)
+	src += genCacheCode(meta, funcName)
 
-	%s
-	meta.Id = primitive.NewObjectID()
-	return %s.Save(meta, nil, &q.query)
-}
-`, funcName, funcName, msrc, meta.Strategy.Storage.Drive, csrc, meta.Strategy.Storage.Drive)
-	} else {
+	// 事务由驱动通过query.Tx识别，mysql为*sql.Tx，mongodb为mongo.SessionContext，框架不支持时不生成
+	if hasTx(meta) {
+		txType := "tx *sql.Tx"
+		if meta.Strategy.Storage.Type == "mongodb" {
+			txType = "sc mongo.SessionContext"
+		}
 		src += fmt.Sprintf(`
-func (q *query%s)Save(meta *Meta%s) error {
-	id, err := %s.Save(meta, &q.query)
-	meta.%s = int(id)
-	return err
+func (q *query%s)WithTx(%s) *query%s {
+	q.query.Tx = %s
+	return q
 }
-`, funcName, funcName, meta.Strategy.Storage.Drive, formatUcfirstName(meta.Key.Name))
+`, funcName, txType, funcName, strings.Fields(txType)[0])
 	}
 
+	src += genSaveCode(meta, funcName)
+	src += genSaveVersionCode(meta, funcName)
+
 	src += fmt.Sprintf(`
 func (q *query%s)Update() (int64, error) {
-	return %s.Update(&q.query)
+	if q.check(false) != nil {
+		return 0, q.err
+	}
+	query := q.updateScope()
+	%s
+	if err := beforeUpdate(&Meta%s{}, query); err != nil {
+		return 0, err
+	}
+	%s
+	%s
 }
-`, funcName, meta.Strategy.Storage.Drive)
+`, funcName, genUpdateTouchCode(meta), funcName, genCacheInvalidateCode(meta), genUpdateExecCode(meta))
+
+	if meta.Strategy.Storage.Type == "mongodb" {
+		src += genValidatorCode(meta, funcName)
+		src += genIndexCode(meta, funcName)
+	}
 
 	src += fmt.Sprintf(`
 func (q *query%s)NewMeta() *Meta%s {
@@ -408,11 +638,142 @@ func (q *query%s)Set%s(val %s, opt ...string) *query%s {
 		args = append(args, val)
 	}
 	q.query.Sets["%s"] = args
+	%s
+	return q
+}
+`, funcName, formatUcfirstName(field.Name), getFieldGolangType(field), funcName, field.Name, genEnumSetCheckCode(meta, field))
+	}
+	return "package " + metaPackage(meta) + "\n" + genImports(append([]string{driveImport}, relationImports(meta)...), src) + src
+}
+
+// 生成代码中可能用到的包，按代码中实际出现的引用决定是否import
+var optionalImports = [][2]string{
+	{"bson", "go.mongodb.org/mongo-driver/bson"},
+	{"primitive", "go.mongodb.org/mongo-driver/bson/primitive"},
+	{"mongo", "go.mongodb.org/mongo-driver/mongo"},
+	{"options", "go.mongodb.org/mongo-driver/mongo/options"},
+	{"sql", "database/sql"},
+	{"time", "time"},
+	{"errors", "errors"},
+	{"strconv", "strconv"},
+	{"crc32", "hash/crc32"},
+	{"driver", "database/sql/driver"},
+	{"json", "encoding/json"},
+	{"regexp", "regexp"},
+	{"utf8", "unicode/utf8"},
+	{"sync", "sync"},
+	{"list", "container/list"},
+	{"rand", "crypto/rand"},
+	{"fmt", "fmt"},
+	{"context", "context"},
+	{"big", "math/big"},
+	{"reflect", "reflect"},
+	{"sort", "sort"},
+	{"strings", "strings"},
+	{"bsontype", "go.mongodb.org/mongo-driver/bson/bsontype"},
+}
+
+// 按生成代码中实际引用的包选择import，注释和字符串中出现的包名不算引用
+func genImports(required []string, src string) string {
+	imports := append([]string{`"` + env.FrameworkName + `"`}, required...)
+	used := usedPackages(src)
+	for _, v := range optionalImports {
+		if used[v[0]] {
+			imports = append(imports, `"`+v[1]+`"`)
+		}
+	}
+	// 其他包通过db.引用library/db中的共享运行时
+	if db := `"` + packagePath("db") + `"`; used["db"] && !inStrings(imports, db) {
+		imports = append(imports, db)
+	}
+	return "\nimport (\n\t" + strings.Join(imports, "\n\t") + "\n)\n"
+}
+
+// 未解析到本文件中声明的标识符作为选择器的前缀时就是引用的包
+func usedPackages(src string) map[string]bool {
+	used := map[string]bool{}
+	file, err := parser.ParseFile(token.NewFileSet(), "", "package p\n"+src, 0)
+	if err != nil {
+		return used
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok && ident.Obj == nil {
+				used[ident.Name] = true
+			}
+		}
+		return true
+	})
+	return used
+}
+
+// 基于主键的游标分页与分批遍历，避免大偏移量的OFFSET扫描。游标与之前的条件整体AND，驱动不支持Group时展开到每个OR分支
+func genIterateCode(meta Meta, funcName string) string {
+	keyName, keyType, group := meta.Key.Name, getKeyGolangType(meta), hasCondition(meta, "Group")
+	return fmt.Sprintf(`
+// After 只查询主键大于key的记录，与PageByKey配合实现游标分页，之前的条件中的OR不会绕过游标，应在添加其他条件之后调用
+func (q *query%s)After(key %s) *query%s {
+	q.query.Conditions = andConditions(q.query.Conditions, %t, play.Condition{AndOr:true, Field:"%s", Con:"Greater", Val:key})
 	return q
 }
-`, funcName, formatUcfirstName(field.Name), getGolangType(field.Type), funcName, field.Name)
+
+// PageByKey 按主键升序返回最多n条记录，下一页以最后一条记录的主键调用After
+func (q *query%s)PageByKey(n int64) ([]Meta%s, error) {
+	q.query.Order = [][2]string{{"%s", "asc"}}
+	q.query.Limit = [2]int64{0, n}
+	return q.GetList()
+}
+
+// Iterate 按主键分批遍历所有满足条件的记录，fn返回错误时停止遍历
+func (q *query%s)Iterate(fn func(meta *Meta%s) error) error {
+	return q.IterateBatch(1000, fn)
+}
+
+// IterateBatch 每次查询size条记录，size必须大于0
+func (q *query%s)IterateBatch(size int64, fn func(meta *Meta%s) error) error {
+	if q.err != nil {
+		return q.err
+	}
+	if size <= 0 {
+		return errors.New("iterate batch size must be greater than 0")
+	}
+
+	conditions := q.query.Conditions
+	page := *q
+	page.query.Order = [][2]string{{"%s", "asc"}}
+	page.query.Limit = [2]int64{0, size}
+	for {
+		list, err := page.GetList()
+		if err != nil {
+			return err
+		}
+		for i := range list {
+			if err = fn(&list[i]); err != nil {
+				return err
+			}
+		}
+		if int64(len(list)) < size {
+			return nil
+		}
+		page.query.Conditions = andConditions(conditions, %t, play.Condition{AndOr:true, Field:"%s", Con:"Greater", Val:list[len(list)-1].%s})
+	}
+}
+`, funcName, keyType, funcName, group, keyName,
+		funcName, funcName, keyName,
+		funcName, funcName,
+		funcName, funcName, keyName, group, keyName, formatUcfirstName(keyName))
+}
+
+func genFieldConsts(meta Meta, funcName string) (code string) {
+	code = fmt.Sprintf("\ntype %sField string\n\nconst (\n", funcName)
+	for _, key := range meta.Keys {
+		code += fmt.Sprintf("\t%sField%s %sField = \"%s\"\n", funcName, formatUcfirstName(key.Name), funcName, key.Name)
+	}
+	for _, field := range meta.Fields.List {
+		code += fmt.Sprintf("\t%sField%s %sField = \"%s\"\n", funcName, formatUcfirstName(field.Name), funcName, field.Name)
 	}
-	return src
+	code += ")\n"
+	return
 }
 
 func getSpTTime(fields MetaFields, t string) (MetaField, error) {
@@ -436,91 +797,93 @@ func writeMeta(meta Meta) (err error) {
 	if unSupportDB {
 		return errors.New("unSupportDB " + meta.Strategy.Storage.Type)
 	}
-
-	path := env.ProjectPath + "/library/db"
-	if err := os.MkdirAll(path, 0744); err != nil {
+	if err = checkIndexes(meta); err != nil {
 		return err
 	}
-
-	filePath := fmt.Sprintf("%s/library/db/%s_%s.go", env.ProjectPath, formatLowerName(meta.Module), formatLowerName(meta.Name))
-	src := generateCode(meta)
-	if err = ioutil.WriteFile(filePath, []byte(src), 0644); err != nil {
-		return
+	if err = checkTx(meta); err != nil {
+		return err
+	}
+	if err = checkCache(meta); err != nil {
+		return err
+	}
+	if err = checkRelations(meta); err != nil {
+		return err
+	}
+	if err = checkRouter(meta); err != nil {
+		return err
+	}
+	if err = checkObjectFields(meta); err != nil {
+		return err
+	}
+	if err = checkPackage(meta); err != nil {
+		return err
 	}
 
-	exec.Command(runtime.GOROOT()+"/bin/gofmt", "-w", filePath).Run()
-	return
+	filename := fmt.Sprintf("%s_%s.go", formatLowerName(meta.Module), formatLowerName(meta.Name))
+	return writeSource(metaPackage(meta), meta.Module+"."+meta.Name, filename, generateCode(meta))
 }
 
-func metaDefaultValue(list []MetaField) string {
-	var s []string
-	for _, field := range list {
-		if field.Type == "string" {
-			s = append(s, fmt.Sprintf(`%s:"%s"`, ucfirst(field.Name), field.Default))
-		} else if field.Type == "int" {
-			s = append(s, fmt.Sprintf(`%s:%s`, ucfirst(field.Name), field.Default))
-		}
-	}
-	return strings.Join(s, ", ")
+func getKeyGolangType(meta Meta) string {
+	return getKeyFieldGolangType(meta, meta.Key)
 }
 
-func genSubObject(meta Meta, funcName string) (code string) {
-	for _, v := range meta.Fields.List {
-		if strings.HasPrefix(v.Type, "array:{") && strings.HasSuffix(v.Type, "}") {
-			keys := strings.Split(v.Type[7:len(v.Type)-1], ",")
-			code = code + fmt.Sprintf("type Meta%s%s struct {\n", funcName, formatUcfirstName(v.Name))
-			for _, v := range keys {
-				code += "\t" + strings.ReplaceAll(strings.TrimSpace(v), ":", "\t") + "\n"
-			}
-			code += "}\n"
-		}
+// Like/NotLike条件的参数是匹配模式，始终为string
+func getCondGolangType(cond string, t string) string {
+	if cond == "Like" || cond == "NotLike" {
+		return "string"
 	}
-	return code
+	return t
 }
 
+// meta字段类型对应的go类型，decimal和json为common.go中定义的类型，objectid只用于mongodb
+var golangTypes = map[string]string{
+	"int":      "int",
+	"int64":    "int64",
+	"uint":     "uint",
+	"uint8":    "uint8",
+	"uint16":   "uint16",
+	"uint32":   "uint32",
+	"uint64":   "uint64",
+	"float":    "float64",
+	"string":   "string",
+	"bool":     "bool",
+	"decimal":  "Decimal",
+	"datetime": "time.Time",
+	"date":     "time.Time",
+	"bytes":    "[]byte",
+	"json":     "JSON",
+	"ctime":    "int64",
+	"mtime":    "int64",
+	"dtime":    "int64",
+	"objectid": "primitive.ObjectID",
+}
+
+// 未知的类型返回空字符串
 func getGolangType(t string) string {
-	if strings.HasPrefix(t, "array") {
-		switch t {
-		case "array":
-			return "[]interface{}"
-		case "array:int":
-			return "[]int"
-		case "array:int64":
-			return "[]int64"
-		case "array:string":
-			return "[]string"
-		case "array:float":
-			return "[]float64"
-		case "array:array":
-			return "[][]interface{}"
-		case "array:object":
-			return "[]interface{}"
-		case "array:map":
-			return "[]map[string]interface{}"
-		}
-	}
-	if strings.HasPrefix(t, "map") {
-		switch t {
-		case "map":
-			return "map[string]interface{}"
-		case "map:int":
-			return "map[string]int"
-		case "map:int64":
-			return "map[string]int64"
-		case "map:string":
-			return "map[string]string"
-		case "map:map:string":
-			return "map[string]map[string]string"
-		}
-	}
-	if t == "ctime" || t == "mtime" || t == "dtime" {
-		return "int64"
-	}
-	if t == "float" {
-		return "float64"
+	switch t {
+	case "array", "array:object":
+		return "[]interface{}"
+	case "array:array":
+		return "[][]interface{}"
+	case "array:map":
+		return "[]map[string]interface{}"
+	case "map":
+		return "map[string]interface{}"
+	case "map:map:string":
+		return "map[string]map[string]string"
 	}
-
-	return t
+	if strings.HasPrefix(t, "array:") || strings.HasPrefix(t, "map:") {
+		elem := t[strings.Index(t, ":")+1:]
+		goType, ok := golangTypes[elem]
+		if !ok || isTimeType(elem) {
+			return ""
+		}
+		if strings.HasPrefix(t, "array:") {
+			return "[]" + goType
+		}
+		return "map[string]" + goType
+	}
+	return golangTypes[t]
 }
 
 func ucfirst(str string) string {
@@ -0,0 +1,592 @@
+package meta
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/leochen2038/goplay/reconst/env"
+)
+
+const testUserXML = `<meta module="shop" name="user">
+  <key name="id" type="auto"/>
+  <fields>
+    <field name="name" type="string" default="anon" required="true" maxlen="20"/>
+    <field name="email" type="string" format="email"/>
+    <field name="age" type="int" min="0" max="200"/>
+    <field name="balance" type="decimal" default="0.00"/>
+    <field name="status" type="enum">
+      <value name="active" value="1"/>
+      <value name="banned" value="2"/>
+    </field>
+    <field name="tags" type="array:string"/>
+    <field name="version" type="int" version="true"/>
+    <field name="ctime" type="ctime"/>
+    <field name="mtime" type="mtime" unit="millisecond"/>
+    <field name="dtime" type="dtime"/>
+  </fields>
+  <strategy>
+    <storage type="mysql" database="shop" table="user"/>
+    <cache type="lru" ttl="60" size="100" keys="id;name"/>
+  </strategy>
+  <relations>
+    <relation name="orders" type="hasMany" module="shop" meta="order" foreign="user_id"/>
+  </relations>
+</meta>
+`
+
+const testOrderXML = `<meta module="shop" name="order">
+  <key name="id" type="string" generate="uuid7"/>
+  <fields>
+    <field name="user_id" type="int"/>
+    <field name="amount" type="float"/>
+    <field name="addr" type="object">
+      <field name="city" type="string"/>
+      <field name="zip" type="string"/>
+    </field>
+    <field name="ctime" type="ctime"/>
+  </fields>
+  <strategy>
+    <storage type="mysql" database="shop" table="order" router="hash(user_id,16)"/>
+  </strategy>
+  <relations>
+    <relation name="user" type="belongsTo" module="shop" meta="user" foreign="user_id"/>
+  </relations>
+</meta>
+`
+
+const testLogXML = `<meta module="audit" name="log">
+  <key name="_id" type="objectid"/>
+  <fields>
+    <field name="msg" type="string"/>
+    <field name="level" type="enum:string">
+      <value name="info" value="info"/>
+      <value name="warn" value="warn"/>
+    </field>
+    <field name="count" type="int64"/>
+    <field name="ctime" type="ctime" unit="time"/>
+    <field name="mtime" type="mtime"/>
+  </fields>
+  <strategy>
+    <storage type="mongodb" database="audit" table="log" validator="true"/>
+    <indexes>
+      <index name="ct" fields="ctime" ttl="3600"/>
+      <index fields="msg,-count" unique="true"/>
+    </indexes>
+  </strategy>
+</meta>
+`
+
+// 在临时目录中按files生成项目，返回library/db下生成的源码，以相对路径为键
+func generateProject(t *testing.T, files map[string]string) (map[string]string, error) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "reconst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	return generateIn(t, dir, files)
+}
+
+func generateIn(t *testing.T, dir string, files map[string]string) (map[string]string, error) {
+	t.Helper()
+	metas, packageFiles, packageDecls = map[string]Meta{}, map[string]map[string]string{}, map[string]map[string]string{}
+	env.ProjectPath, env.FrameworkName = dir, "github.com/leochen2038/play"
+	// 默认按框架提供全部接口生成，目录中有框架桩时按桩中的接口生成
+	FrameworkAPIs = map[string]bool{}
+	for name := range frameworkAPIs {
+		FrameworkAPIs[name] = true
+	}
+	for _, pkg := range []string{"mysql", "mongodb"} {
+		for _, con := range frameworkConditions {
+			FrameworkAPIs[pkg+".Condition."+con] = true
+		}
+	}
+	if _, err := os.Stat(dir + "/play"); err == nil {
+		LoadFrameworkAPIs(dir + "/play")
+	}
+	if env.ModuleName == "" {
+		env.ModuleName = "proj"
+	}
+	for name, data := range files {
+		if err := os.MkdirAll(dir+"/assets/meta", 0744); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(dir+"/assets/meta/"+name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := MetaGenerator(); err != nil {
+		return nil, err
+	}
+
+	sources := map[string]string{}
+	err := filepath.Walk(dir+"/library/db", func(filename string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir+"/library/db", filename)
+		sources[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sources, nil
+}
+
+// frameworkProject 创建使用testdata/play中框架桩的项目目录，released时去掉v0.4.5之后加入的接口
+func frameworkProject(t *testing.T, released bool) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "reconst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = filepath.Walk("testdata/play", func(filename string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() || (released && strings.HasSuffix(filename, "_next.go")) {
+			return err
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		if released {
+			lines := strings.Split(string(data), "\n")
+			for i := len(lines) - 1; i >= 0; i-- {
+				if strings.HasSuffix(lines[i], "// next") {
+					lines = append(lines[:i], lines[i+1:]...)
+				}
+			}
+			data = []byte(strings.Join(lines, "\n"))
+		}
+		target := filepath.Join(dir, "play", strings.TrimPrefix(filename, filepath.Join("testdata", "play")))
+		if err = os.MkdirAll(filepath.Dir(target), 0744); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, data, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gomod := "module proj\n\ngo 1.14\n\nrequire (\n\tgithub.com/leochen2038/play v0.4.5\n\tgo.mongodb.org/mongo-driver v1.17.6\n)\n\nreplace github.com/leochen2038/play => ./play\n"
+	if err = ioutil.WriteFile(dir+"/go.mod", []byte(gomod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// buildProject 在框架桩项目中生成files并执行go vet，tests为写入library/db的测试文件，不为空时再执行go test运行生成的代码
+func buildProject(t *testing.T, files map[string]string, released bool, tests map[string]string) map[string]string {
+	t.Helper()
+	dir := frameworkProject(t, released)
+	defer os.RemoveAll(dir)
+
+	module := env.ModuleName
+	defer func() { env.ModuleName = module }()
+	env.ModuleName = "proj"
+	sources, err := generateIn(t, dir, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, src := range tests {
+		if err = ioutil.WriteFile(dir+"/library/db/"+name, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 离线使用模块缓存中的mongo-driver，缓存中没有时跳过
+	commands := [][]string{{"vet", "./..."}}
+	if len(tests) > 0 {
+		commands = append(commands, []string{"test", "./..."})
+	}
+	for _, args := range commands {
+		cmd := exec.Command("go", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOSUMDB=off", "GOWORK=off")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			if strings.Contains(string(out), "go.mongodb.org/mongo-driver") && strings.Contains(string(out), "GOPROXY=off") {
+				t.Skipf("go.mongodb.org/mongo-driver v1.17.6 is not in the module cache:\n%s", out)
+			}
+			t.Fatalf("go %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	return sources
+}
+
+func mustGenerate(t *testing.T, files map[string]string) map[string]string {
+	t.Helper()
+	sources, err := generateProject(t, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sources
+}
+
+// 解析生成的源码，返回顶层声明，方法以接收者类型名.方法名记录
+func declNames(t *testing.T, filename string, src string) map[string]bool {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), filename, src, 0)
+	if err != nil {
+		t.Fatalf("%s does not parse: %v", filename, err)
+	}
+	names := map[string]bool{}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				names[d.Name.Name] = true
+			} else {
+				names[recvTypeName(d.Recv)+"."+d.Name.Name] = true
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					names[s.Name.Name] = true
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						names[name.Name] = true
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+func assertDecls(t *testing.T, sources map[string]string, filename string, want ...string) {
+	t.Helper()
+	src, ok := sources[filename]
+	if !ok {
+		t.Fatalf("%s is not generated", filename)
+	}
+	names := declNames(t, filename, src)
+	for _, name := range want {
+		if !names[name] {
+			t.Errorf("%s does not declare %s", filename, name)
+		}
+	}
+}
+
+func assertNoDecls(t *testing.T, sources map[string]string, filename string, unwanted ...string) {
+	t.Helper()
+	names := declNames(t, filename, sources[filename])
+	for _, name := range unwanted {
+		if names[name] {
+			t.Errorf("%s should not declare %s", filename, name)
+		}
+	}
+}
+
+func assertContains(t *testing.T, sources map[string]string, filename string, want ...string) {
+	t.Helper()
+	for _, s := range want {
+		if !strings.Contains(sources[filename], s) {
+			t.Errorf("%s does not contain:\n%s", filename, s)
+		}
+	}
+}
+
+// 返回生成代码中名为name的函数或方法的源码
+func funcSource(t *testing.T, sources map[string]string, filename string, name string) string {
+	t.Helper()
+	src := sources[filename]
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		t.Fatalf("%s does not parse: %v", filename, err)
+	}
+	for _, decl := range file.Decls {
+		if d, ok := decl.(*ast.FuncDecl); ok {
+			declName := d.Name.Name
+			if d.Recv != nil {
+				declName = recvTypeName(d.Recv) + "." + declName
+			}
+			if declName == name {
+				return src[fset.Position(d.Pos()).Offset:fset.Position(d.End()).Offset]
+			}
+		}
+	}
+	t.Fatalf("%s does not declare %s", filename, name)
+	return ""
+}
+
+func assertError(t *testing.T, err error, want string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("want error containing %q, got nil", want)
+	}
+	if !strings.Contains(err.Error(), want) {
+		t.Fatalf("want error containing %q, got %q", want, err.Error())
+	}
+}
+
+func TestGenerateParses(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML, "log.xml": testLogXML})
+	for _, filename := range []string{"common.go", "index.go", "shop_user.go", "shop_order.go", "audit_log.go"} {
+		if _, ok := sources[filename]; !ok {
+			t.Errorf("%s is not generated", filename)
+			continue
+		}
+		declNames(t, filename, sources[filename])
+	}
+}
+
+func TestTypedConditions(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML})
+	assertContains(t, sources, "shop_user.go",
+		"func (q *queryShopUser) WhereAgeEqual(val int) *queryShopUser {",
+		"func (q *queryShopUser) WhereNameIn(s []string) *queryShopUser {",
+		"func (q *queryShopUser) WhereStatusEqual(val ShopUserStatus) *queryShopUser {",
+		"func (q *queryShopUser) WhereAgeBetween(v1 int, v2 int) *queryShopUser {",
+	)
+	if strings.Contains(sources["shop_user.go"], "(val interface{}) *queryShopUser") {
+		t.Error("condition methods should not take interface{} values")
+	}
+}
+
+func TestQueryBuilderConditions(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML})
+	assertDecls(t, sources, "shop_user.go",
+		"queryShopUser.WhereAgeIsNull",
+		"queryShopUser.OrAgeIsNotNull",
+		"queryShopUser.WhereNameNotLike",
+		"queryShopUser.WhereAgeNotBetween",
+		"queryShopUser.WhereNameNotIn",
+		"queryShopUser.WhereGroup",
+		"queryShopUser.OrGroup",
+		"queryShopUser.WhereRaw",
+		"queryShopUser.OrRaw",
+	)
+	assertContains(t, sources, "shop_user.go", `play.Condition{AndOr: true, Con: "Group", Val: g.query.Conditions}`)
+	assertContains(t, sources, "common.go", "func checkRawExpr(expr string, args []interface{}) error {")
+}
+
+const testTagXML = `<meta module="shop" name="tag">
+  <key name="id" type="auto"/>
+  <fields>
+    <field name="name" type="string"/>
+    <field name="weight" type="int"/>
+  </fields>
+  <strategy>
+    <storage type="mysql" database="shop" table="tag"/>
+  </strategy>
+</meta>
+`
+
+// 驱动按Con分支处理条件，已发布的框架不支持的条件不生成对应的方法
+func TestQueryConditionsNeedFramework(t *testing.T) {
+	dir := frameworkProject(t, true)
+	defer os.RemoveAll(dir)
+	missing := LoadFrameworkAPIs(dir + "/play")
+	for _, name := range []string{"mysql.Condition.IsNull", "mysql.Condition.Group", "mysql.Condition.Raw", "mongodb.Condition.NotLike"} {
+		if !inStrings(missing, name) {
+			t.Errorf("%s should be missing from the released framework", name)
+		}
+	}
+	if inStrings(missing, "mongodb.Condition.Raw") || inStrings(missing, "mysql.Condition.Equal") {
+		t.Errorf("unexpected missing conditions: %v", missing)
+	}
+
+	sources := buildProject(t, map[string]string{"tag.xml": testTagXML}, true, map[string]string{"condition_test.go": `package db
+
+import "testing"
+
+func TestReleasedConditions(t *testing.T) {
+	if _, err := ShopTag().WhereNameLike("a%").OrWeightBetween(1, 2).WhereIdNotIn([]int{3}).GetList(); err != nil {
+		t.Error(err)
+	}
+}
+`})
+	assertDecls(t, sources, "shop_tag.go", "queryShopTag.WhereNameLike", "queryShopTag.WhereWeightBetween")
+	assertNoDecls(t, sources, "shop_tag.go", "queryShopTag.WhereNameIsNull", "queryShopTag.WhereNameNotLike",
+		"queryShopTag.WhereWeightLessOrEqual", "queryShopTag.WhereWeightNotBetween", "queryShopTag.WhereGroup", "queryShopTag.WhereRaw")
+}
+
+func TestQueryConditionsRun(t *testing.T) {
+	buildProject(t, map[string]string{"tag.xml": testTagXML}, false, map[string]string{"condition_test.go": `package db
+
+import "testing"
+
+func TestConditions(t *testing.T) {
+	q := ShopTag().WhereNameIsNotNull().WhereGroup(func(g *queryShopTag) {
+		g.WhereWeightLessOrEqual(1).OrWeightNotBetween(0, 10)
+	}).WhereNameNotLike("b%").WhereRaw("weight % ? = 0", 2)
+	if _, err := q.GetList(); err != nil {
+		t.Fatalf("driver: %v", err)
+	}
+
+	defer UseShopTagStore(NewShopTagMemoryStore(
+		MetaShopTag{Id: 1, Name: "a", Weight: 1},
+		MetaShopTag{Id: 2, Name: "b", Weight: 20},
+		MetaShopTag{Id: 3, Name: "c", Weight: 5},
+	))()
+	list, err := ShopTag().WhereGroup(func(g *queryShopTag) {
+		g.WhereWeightLessOrEqual(1).OrWeightNotBetween(0, 10)
+	}).WhereNameNotLike("b%").GetList()
+	if err != nil || len(list) != 1 || list[0].Id != 1 {
+		t.Errorf("memory store: %+v, %v", list, err)
+	}
+}
+`})
+}
+
+func TestSelectOmitKeepsKey(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML})
+	assertDecls(t, sources, "shop_user.go", "ShopUserField", "ShopUserFieldName", "queryShopUser.Select", "queryShopUser.Omit")
+	omit := funcSource(t, sources, "shop_user.go", "queryShopUser.Omit")
+	if !strings.Contains(omit, `q.query.Fields["id"] = true`) {
+		t.Errorf("Omit should keep the key field:\n%s", omit)
+	}
+}
+
+// 游标与之前的条件整体AND，OR条件不能绕过游标，已发布的框架不支持Group时展开到每个OR分支
+func TestAfterKeepsConditions(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML})
+	assertDecls(t, sources, "shop_user.go", "queryShopUser.After", "queryShopUser.PageByKey", "queryShopUser.Iterate", "queryShopUser.IterateBatch")
+
+	test := `package db
+
+import "testing"
+
+func TestIterate(t *testing.T) {
+	if _, err := ShopTag().WhereNameEqual("a").OrWeightGreater(5).After(1).PageByKey(10); err != nil {
+		t.Fatalf("driver: %v", err)
+	}
+
+	defer UseShopTagStore(NewShopTagMemoryStore(
+		MetaShopTag{Id: 1, Name: "a", Weight: 1},
+		MetaShopTag{Id: 2, Name: "b", Weight: 9},
+		MetaShopTag{Id: 3, Name: "a", Weight: 2},
+		MetaShopTag{Id: 4, Name: "c", Weight: 1},
+		MetaShopTag{Id: 5, Name: "a", Weight: 7},
+	))()
+	list, err := ShopTag().WhereNameEqual("a").OrWeightGreater(5).After(2).PageByKey(10)
+	if err != nil || len(list) != 2 || list[0].Id != 3 || list[1].Id != 5 {
+		t.Errorf("After(2) = %+v, %v", list, err)
+	}
+
+	var ids []int
+	err = ShopTag().WhereNameEqual("a").OrWeightGreater(5).IterateBatch(2, func(meta *MetaShopTag) error {
+		ids = append(ids, meta.Id)
+		return nil
+	})
+	if err != nil || len(ids) != 4 || ids[0] != 1 || ids[1] != 2 || ids[2] != 3 || ids[3] != 5 {
+		t.Errorf("IterateBatch = %v, %v", ids, err)
+	}
+}
+`
+	for _, released := range []bool{false, true} {
+		buildProject(t, map[string]string{"tag.xml": testTagXML}, released, map[string]string{"iterate_test.go": test})
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML, "log.xml": testLogXML})
+	assertDecls(t, sources, "common.go", "Tx", "AfterCommit")
+	assertContains(t, sources, "shop_user.go", "func (q *queryShopUser) WithTx(tx *sql.Tx) *queryShopUser {")
+	assertContains(t, sources, "audit_log.go", "func (q *queryAuditLog) WithTx(sc mongo.SessionContext) *queryAuditLog {")
+
+	// 已发布的框架没有play.Query.Tx和mysql.Begin，不生成事务代码
+	dir := frameworkProject(t, true)
+	defer os.RemoveAll(dir)
+	sources, err := generateIn(t, dir, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML, "log.xml": testLogXML})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNoDecls(t, sources, "common.go", "Tx", "AfterCommit")
+	assertNoDecls(t, sources, "shop_user.go", "queryShopUser.WithTx")
+	assertNoDecls(t, sources, "audit_log.go", "queryAuditLog.WithTx")
+	for filename, src := range sources {
+		if strings.Contains(src, "query.Tx") {
+			t.Errorf("%s should not reference query.Tx", filename)
+		}
+	}
+
+	// 显式声明tx="true"的meta在框架不支持事务时报错
+	_, err = generateIn(t, dir, map[string]string{"user.xml": strings.Replace(testUserXML, `table="user"`, `table="user" tx="true"`, 1), "order.xml": testOrderXML})
+	assertError(t, err, "tx requires play.Query.Tx and mysql.Begin, which are not provided by github.com/leochen2038/play")
+	_, err = generateIn(t, dir, map[string]string{"log.xml": strings.Replace(testLogXML, `validator="true"`, `validator="true" tx="true"`, 1)})
+	assertError(t, err, "tx requires play.Query.Tx, which is not provided by github.com/leochen2038/play")
+	sources = mustGenerate(t, map[string]string{"log.xml": strings.Replace(testLogXML, `validator="true"`, `validator="true" tx="true"`, 1)})
+	assertDecls(t, sources, "audit_log.go", "queryAuditLog.WithTx")
+}
+
+func TestTransactionsRun(t *testing.T) {
+	buildProject(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML}, false, map[string]string{"tx_test.go": `package db
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/leochen2038/play/database/mysql"
+)
+
+func TestTx(t *testing.T) {
+	called := false
+	err := Tx("shop", func(tx *sql.Tx) error {
+		called = true
+		return nil
+	})
+	if err == nil || called || mysql.Calls[len(mysql.Calls)-1] != "Begin" {
+		t.Fatalf("Tx should return the Begin error without calling fn: %v", err)
+	}
+
+	restore := UseShopUserStore(NewShopUserMemoryStore())
+	defer restore()
+	tx := &sql.Tx{}
+	if q := ShopUser().WithTx(tx); q.query.Tx != tx {
+		t.Fatal("WithTx should set query.Tx")
+	}
+	for _, inTx := range []bool{false, true} {
+		loads := 0
+		for i := 0; i < 2; i++ {
+			q := ShopUser().WhereIdEqual(1)
+			if inTx {
+				q.WithTx(tx)
+			}
+			q.cached("one", &MetaShopUser{}, func() error { loads++; return nil })
+		}
+		if want := map[bool]int{false: 1, true: 2}[inTx]; loads != want {
+			t.Errorf("in transaction %v: loads = %d, want %d", inTx, loads, want)
+		}
+	}
+}
+`})
+}
+
+func TestImportsFollowUsage(t *testing.T) {
+	const tagXML = `<meta module="shop" name="tag">
+  <key name="id" type="auto"/>
+  <fields>
+    <field name="kind" type="enum" note="see time.Now"><value name="a" value="1" note="mirrors crc32.Size"/></field>
+    <field name="code" type="string" pattern="^json\.x|time\.y$"/>
+  </fields>
+  <strategy>
+    <storage type="mysql" database="shop" table="tag"/>
+  </strategy>
+</meta>
+`
+	sources := mustGenerate(t, map[string]string{"tag.xml": tagXML})
+	for _, path := range []string{`"hash/crc32"`, `"encoding/json"`} {
+		if strings.Contains(sources["shop_tag.go"], path) {
+			t.Errorf("shop_tag.go should not import %s mentioned only in text", path)
+		}
+	}
+	if used := usedPackages("func f() {\n\t// json.Marshal\n}"); used["json"] {
+		t.Error("usedPackages should ignore comments")
+	}
+	if used := usedPackages("func f() { strings.TrimSpace(\"\") }"); !used["strings"] {
+		t.Error("usedPackages should find selector expressions")
+	}
+}
@@ -0,0 +1,95 @@
+package meta
+
+import (
+	"fmt"
+)
+
+// Save、Insert、SaveMany、Upsert、UpdateMany在写入前后调用Meta实现的BeforeSave/AfterSave，框架不支持的批量写入不生成，
+// 钩子方法写在单独的文件中，不会被play reconst覆盖
+func genHookCode(meta Meta, funcName string) string {
+	invalidate := genCacheInvalidateCode(meta)
+	code := fmt.Sprintf(`
+// Save 写入一条记录，Meta实现BeforeSave/AfterSave时在写入前后调用。
+// 主键在写入时分配的meta，主键为零值时插入，否则更新；主键由调用方给出的meta按主键upsert
+func (q *query%s)Save(meta *Meta%s) error {
+	%s
+	if err := beforeSave(meta); err != nil {
+		return err
+	}
+	if err := q.save(meta, %s); err != nil {
+		return err
+	}
+	return afterSave(meta)
+}
+
+// Insert 插入一条新记录，主键由调用方给出或按generate策略生成
+func (q *query%s)Insert(meta *Meta%s) error {
+	%s
+	if err := beforeSave(meta); err != nil {
+		return err
+	}
+	if err := q.save(meta, true); err != nil {
+		return err
+	}
+	return afterSave(meta)
+}
+`, funcName, funcName, invalidate, genSaveInsertExpr(meta), funcName, funcName, invalidate)
+
+	saveMany := fmt.Sprintf(`
+// SaveMany 写入多条记录，每条记录都会调用BeforeSave/AfterSave
+func (q *query%s)SaveMany(list []*Meta%s) error {
+	%s
+	for _, meta := range list {
+		if err := beforeSave(meta); err != nil {
+			return err
+		}
+	}
+	if err := q.saveMany(list); err != nil {
+		return err
+	}
+	for _, meta := range list {
+		if err := afterSave(meta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+`, funcName, funcName, invalidate)
+
+	upsert := fmt.Sprintf(`
+// Upsert 写入或更新一条记录，前后调用BeforeSave/AfterSave
+func (q *query%s)Upsert(meta *Meta%s, conflict ...%sField) error {
+	%s
+	if err := beforeSave(meta); err != nil {
+		return err
+	}
+	if err := q.upsert(meta, conflict...); err != nil {
+		return err
+	}
+	return afterSave(meta)
+}
+`, funcName, funcName, funcName, invalidate)
+
+	updateMany := fmt.Sprintf(`
+// UpdateMany 按主键更新多条记录，每条记录都会调用BeforeSave/AfterSave
+func (q *query%s)UpdateMany(list []*Meta%s) (int64, error) {
+	%s
+	for _, meta := range list {
+		if err := beforeSave(meta); err != nil {
+			return 0, err
+		}
+	}
+	n, err := q.updateMany(list)
+	if err != nil {
+		return n, err
+	}
+	for _, meta := range list {
+		if err := afterSave(meta); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+`, funcName, funcName, invalidate)
+	return code + genBatchMethods(meta, saveMany, upsert, updateMany)
+}
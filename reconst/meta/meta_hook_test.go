@@ -0,0 +1,33 @@
+package meta
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLifecycleHooks(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML})
+	assertDecls(t, sources, "common.go", "BeforeSaver", "AfterSaver", "BeforeUpdater", "BeforeDeleter", "AfterFinder",
+		"beforeSave", "afterSave", "beforeUpdate", "beforeDelete", "afterFind")
+
+	calls := map[string][]string{
+		"queryShopUser.Save":        {"beforeSave(meta)", "afterSave(meta)"},
+		"queryShopUser.Insert":      {"beforeSave(meta)", "afterSave(meta)"},
+		"queryShopUser.SaveMany":    {"beforeSave(meta)", "afterSave(meta)"},
+		"queryShopUser.Upsert":      {"beforeSave(meta)", "afterSave(meta)"},
+		"queryShopUser.UpdateMany":  {"beforeSave(meta)", "afterSave(meta)"},
+		"queryShopUser.Update":      {"beforeUpdate(&MetaShopUser{}, query)"},
+		"queryShopUser.Delete":      {"beforeDelete(&MetaShopUser{}, q.scope())"},
+		"queryShopUser.ForceDelete": {"beforeDelete(&MetaShopUser{}, q.scope())"},
+		"queryShopUser.GetOne":      {"afterFind(meta)"},
+		"queryShopUser.GetList":     {"afterFind(&list[i])"},
+	}
+	for name, want := range calls {
+		src := funcSource(t, sources, "shop_user.go", name)
+		for _, call := range want {
+			if !strings.Contains(src, call) {
+				t.Errorf("%s does not call %s:\n%s", name, call, src)
+			}
+		}
+	}
+}
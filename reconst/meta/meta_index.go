@@ -0,0 +1,168 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 把meta字段类型映射为$jsonSchema的bsonType
+var bsonTypes = map[string]string{
+	"int":         `[]string{"int", "long"}`,
+	"int64":       `[]string{"int", "long"}`,
+	"ctime":       `[]string{"int", "long"}`,
+	"mtime":       `[]string{"int", "long"}`,
+	"dtime":       `[]string{"int", "long"}`,
+	"float":       `[]string{"double", "int", "long"}`,
+	"string":      `"string"`,
+	"bool":        `"bool"`,
+	"uint":        `[]string{"int", "long"}`,
+	"uint8":       `[]string{"int", "long"}`,
+	"uint16":      `[]string{"int", "long"}`,
+	"uint32":      `[]string{"int", "long"}`,
+	"uint64":      `[]string{"int", "long"}`,
+	"decimal":     `"decimal"`,
+	"datetime":    `"date"`,
+	"date":        `"date"`,
+	"bytes":       `[]string{"binData", "null"}`,
+	"object":      `"object"`,
+	"objectid":    `"objectId"`,
+	"enum":        `[]string{"int", "long"}`,
+	"enum:string": `"string"`,
+}
+
+func getBsonType(field MetaField) string {
+	t := field.Type
+	if isTimeType(t) && field.Unit == "time" {
+		return `"date"`
+	}
+	if bt, ok := bsonTypes[t]; ok {
+		return bt
+	}
+	if strings.HasPrefix(t, "array") {
+		return `[]string{"array", "null"}`
+	}
+	if strings.HasPrefix(t, "map") {
+		return `[]string{"object", "null"}`
+	}
+	return ""
+}
+
+// 索引和校验只在meta中声明时生成，直接通过mongo官方驱动创建，不依赖框架的驱动函数
+func checkIndexes(meta Meta) error {
+	if meta.Strategy.Storage.Validator && meta.Strategy.Storage.Type != "mongodb" {
+		return errors.New("validator only supports mongodb storage")
+	}
+	if len(meta.Strategy.Indexes.List) == 0 {
+		return nil
+	}
+	if meta.Strategy.Storage.Type != "mongodb" {
+		return errors.New("indexes only support mongodb storage")
+	}
+
+	names := map[string]bool{meta.Key.Name: true}
+	fields := map[string]MetaField{}
+	for _, v := range meta.Fields.List {
+		names[v.Name] = true
+		fields[v.Name] = v
+	}
+	for _, index := range meta.Strategy.Indexes.List {
+		keys := strings.Split(index.Fields, ",")
+		for _, key := range keys {
+			key = strings.TrimPrefix(strings.TrimSpace(key), "-")
+			if key == "" {
+				return errors.New("index " + index.Name + " has empty field")
+			}
+			if !names[key] {
+				return errors.New("index " + index.Name + " unknown field " + key)
+			}
+		}
+		if index.TTL > 0 && len(keys) > 1 {
+			return errors.New("ttl index " + index.Name + " must be a single field index")
+		}
+		// mongodb只会让BSON date类型的字段过期，整数时间戳的记录永远不会被删除
+		if key := strings.TrimPrefix(strings.TrimSpace(keys[0]), "-"); index.TTL > 0 && getBsonType(fields[key]) != `"date"` {
+			return errors.New("ttl index " + index.Name + " field " + key + " must be date, datetime or a time field with unit=\"time\"")
+		}
+	}
+	return nil
+}
+
+func genIndexCode(meta Meta, funcName string) (code string) {
+	if len(meta.Strategy.Indexes.List) == 0 {
+		return
+	}
+
+	code = fmt.Sprintf("\nvar indexes%s = []mongo.IndexModel{\n", funcName)
+	for _, index := range meta.Strategy.Indexes.List {
+		var keys []string
+		for _, key := range strings.Split(index.Fields, ",") {
+			key = strings.TrimSpace(key)
+			if strings.HasPrefix(key, "-") {
+				keys = append(keys, fmt.Sprintf(`{Key: "%s", Value: -1}`, key[1:]))
+			} else {
+				keys = append(keys, fmt.Sprintf(`{Key: "%s", Value: 1}`, key))
+			}
+		}
+
+		opts := "options.Index()"
+		if index.Name != "" {
+			opts += fmt.Sprintf(`.SetName("%s")`, index.Name)
+		}
+		if index.Unique {
+			opts += ".SetUnique(true)"
+		}
+		if index.TTL > 0 {
+			opts += fmt.Sprintf(".SetExpireAfterSeconds(%d)", index.TTL)
+		}
+		code += fmt.Sprintf("\t{Keys: bson.D{%s}, Options: %s},\n", strings.Join(keys, ", "), opts)
+	}
+	code += "}\n"
+
+	code += fmt.Sprintf(`
+// Ensure%sIndexes 在db的%s集合上创建meta中声明的索引，db为meta的database对应的数据库
+func Ensure%sIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("%s").Indexes().CreateMany(ctx, indexes%s)
+	return err
+}
+`, funcName, meta.Strategy.Storage.Table, funcName, meta.Strategy.Storage.Table, funcName)
+	return
+}
+
+func genValidatorCode(meta Meta, funcName string) (code string) {
+	if !meta.Strategy.Storage.Validator {
+		return
+	}
+	code = fmt.Sprintf(`
+var validator%s = bson.M{"$jsonSchema": bson.M{
+	"bsonType": "object",
+	"required": []string{"%s"},
+	"properties": bson.M{
+		"%s": bson.M{"bsonType": "objectId"},
+`, funcName, meta.Key.Name, meta.Key.Name)
+	for _, v := range meta.Fields.List {
+		if bt := getBsonType(v); bt != "" && isEnumType(v.Type) {
+			var values []string
+			for _, ev := range v.Values {
+				values = append(values, enumValueExpr(v, ev))
+			}
+			code += fmt.Sprintf("\t\t\"%s\": bson.M{\"bsonType\": %s, \"enum\": []interface{}{%s}},\n", v.Name, bt, strings.Join(values, ", "))
+		} else if bt != "" {
+			code += fmt.Sprintf("\t\t\"%s\": bson.M{\"bsonType\": %s},\n", v.Name, bt)
+		}
+	}
+	code += "\t},\n}}\n"
+
+	code += fmt.Sprintf(`
+// Ensure%sValidator 通过collMod为db的%s集合设置$jsonSchema校验，集合不存在时创建带校验的集合
+func Ensure%sValidator(ctx context.Context, db *mongo.Database) error {
+	err := db.RunCommand(ctx, bson.D{{Key: "collMod", Value: "%s"}, {Key: "validator", Value: validator%s}}).Err()
+	// NamespaceNotFound
+	if e, ok := err.(mongo.CommandError); ok && e.Code == 26 {
+		return db.CreateCollection(ctx, "%s", options.CreateCollection().SetValidator(validator%s))
+	}
+	return err
+}
+`, funcName, meta.Strategy.Storage.Table, funcName, meta.Strategy.Storage.Table, funcName, meta.Strategy.Storage.Table, funcName)
+	return
+}
@@ -0,0 +1,117 @@
+package meta
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMongoIndexesAndValidator(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"log.xml": testLogXML})
+	assertDecls(t, sources, "audit_log.go", "indexesAuditLog", "EnsureAuditLogIndexes", "validatorAuditLog", "EnsureAuditLogValidator")
+	assertContains(t, sources, "audit_log.go",
+		`"level": bson.M{"bsonType": "string", "enum": []interface{}{"info", "warn"}},`,
+		`"ctime": bson.M{"bsonType": "date"},`,
+	)
+}
+
+func TestCheckIndexes(t *testing.T) {
+	tests := []struct {
+		index string
+		err   string
+	}{
+		{`<index name="a" fields="nope"/>`, "index a unknown field nope"},
+		{`<index name="a" fields="msg,count" ttl="60"/>`, "ttl index a must be a single field index"},
+		{`<index name="a" fields="count" ttl="60"/>`, "ttl index a field count must be date, datetime or a time field"},
+	}
+	for _, tt := range tests {
+		src := strings.Replace(testLogXML, `<index fields="msg,-count" unique="true"/>`, tt.index, 1)
+		_, err := generateProject(t, map[string]string{"log.xml": src})
+		assertError(t, err, tt.err)
+	}
+
+	mysql := strings.Replace(testUserXML, `<cache type="lru" ttl="60" size="100" keys="id;name"/>`, `<indexes><index fields="name"/></indexes>`, 1)
+	_, err := generateProject(t, map[string]string{"user.xml": mysql, "order.xml": testOrderXML})
+	assertError(t, err, "indexes only support mongodb storage")
+}
+
+// 只有声明了索引或validator="true"的meta生成Ensure函数，它们直接调用mongo驱动，已发布的框架也生成
+func TestIndexesAndValidatorAreDeclared(t *testing.T) {
+	src := strings.Replace(testLogXML, ` validator="true"`, ``, 1)
+	src = src[:strings.Index(src, "    <indexes>")] + src[strings.Index(src, "  </strategy>"):]
+	sources := mustGenerate(t, map[string]string{"log.xml": src})
+	assertNoDecls(t, sources, "audit_log.go", "indexesAuditLog", "EnsureAuditLogIndexes", "validatorAuditLog", "EnsureAuditLogValidator")
+
+	dir := frameworkProject(t, true)
+	defer os.RemoveAll(dir)
+	sources, err := generateIn(t, dir, map[string]string{"log.xml": testLogXML})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertDecls(t, sources, "audit_log.go", "indexesAuditLog", "EnsureAuditLogIndexes", "validatorAuditLog", "EnsureAuditLogValidator")
+
+	mysql := strings.Replace(testUserXML, `table="user"`, `table="user" validator="true"`, 1)
+	_, err = generateProject(t, map[string]string{"user.xml": mysql, "order.xml": testOrderXML})
+	assertError(t, err, "validator only supports mongodb storage")
+}
+
+// 生成的代码只使用v0.4.5的接口时可以对照已发布的框架编译
+func TestReleasedFrameworkBuilds(t *testing.T) {
+	files := testPackageMetas()
+	files["log.xml"] = testLogXML
+	files["stock.xml"] = testTypesXML
+	files["bill.xml"] = testShardXML
+	files["topic.xml"] = testTopicXML
+	files["reply.xml"] = testReplyXML
+	buildProject(t, files, true, nil)
+}
+
+// Ensure函数对mongo驱动的集合调用CreateMany和collMod，连不上服务器时返回驱动的错误
+func TestEnsureIndexesRun(t *testing.T) {
+	buildProject(t, map[string]string{"log.xml": testLogXML}, true, map[string]string{"index_test.go": `package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestIndexModels(t *testing.T) {
+	if len(indexesAuditLog) != 2 {
+		t.Fatalf("indexes = %d, want 2", len(indexesAuditLog))
+	}
+	unique := indexesAuditLog[1]
+	if keys := unique.Keys.(bson.D); len(keys) != 2 || keys[0].Key != "msg" || keys[1].Value != -1 {
+		t.Errorf("keys = %v", keys)
+	}
+	if unique.Options.Unique == nil || !*unique.Options.Unique {
+		t.Errorf("index should be unique")
+	}
+	schema := validatorAuditLog["$jsonSchema"].(bson.M)
+	if _, ok := schema["properties"].(bson.M)["level"]; !ok {
+		t.Errorf("validator should check level: %v", schema)
+	}
+}
+
+func TestEnsure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://127.0.0.1:1").SetServerSelectionTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(ctx)
+	db := client.Database("audit")
+	if err := EnsureAuditLogIndexes(ctx, db); err == nil {
+		t.Error("EnsureAuditLogIndexes should fail without a server")
+	}
+	if err := EnsureAuditLogValidator(ctx, db); err == nil {
+		t.Error("EnsureAuditLogValidator should fail without a server")
+	}
+}
+`})
+}
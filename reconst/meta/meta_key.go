@@ -0,0 +1,227 @@
+package meta
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+)
+
+// mysql主键支持的类型，auto为int自增主键
+var keyTypes = []string{"auto", "int", "int64", "string"}
+
+// 主键的生成策略，新记录主键为零值时在写入前生成
+var keyGenerates = map[string]string{
+	"uuid4":     "string",
+	"uuid7":     "string",
+	"snowflake": "int64",
+}
+
+var keyGenerateFuncs = map[string]string{
+	"uuid4":     "newUUID(4)",
+	"uuid7":     "newUUID(7)",
+	"snowflake": "NextSnowflake()",
+}
+
+// 雪花ID的序号在library/db中共享，其他包中的meta通过db.NextSnowflake生成
+func keyGenerateExpr(meta Meta) string {
+	if meta.Key.Generate == "snowflake" {
+		return runtimeName(meta, keyGenerateFuncs[meta.Key.Generate])
+	}
+	return keyGenerateFuncs[meta.Key.Generate]
+}
+
+func isCompositeKey(meta Meta) bool {
+	return len(meta.Keys) > 1
+}
+
+func getKeyFieldGolangType(meta Meta, key MetaField) string {
+	if meta.Strategy.Storage.Type == "mongodb" {
+		return "primitive.ObjectID"
+	}
+	if key.Type == "auto" {
+		return "int"
+	}
+	return getGolangType(key.Type)
+}
+
+// 只有type为auto的主键由数据库自增，写入后需要回填，int、int64主键由调用方或generate策略给出
+func isAutoIncrementKey(meta Meta) bool {
+	return !isCompositeKey(meta) && meta.Key.Type == "auto" && meta.Strategy.Storage.Type != "mongodb"
+}
+
+func checkKeys(meta Meta, lines metaLines, verr *validateErrors) {
+	mongo := meta.Strategy.Storage.Type == "mongodb"
+	if isCompositeKey(meta) {
+		if mongo {
+			verr.addLine(lines.line(lines.keys, 1), "composite key is only supported by mysql storage")
+		}
+		if version, ok := getVersionField(meta); ok {
+			verr.addLine(lines.meta, "version field %q is not supported with composite key", version.Name)
+		}
+	}
+
+	for i, key := range meta.Keys {
+		line := lines.line(lines.keys, i)
+		if !mongo && !inStrings(keyTypes, key.Type) {
+			verr.addLine(line, "key %q type must be one of %s", key.Name, strings.Join(keyTypes, ", "))
+		}
+		if key.Type == "auto" && isCompositeKey(meta) {
+			verr.addLine(line, "key %q auto increment is not supported in composite key", key.Name)
+		}
+		if key.Generate == "" {
+			continue
+		}
+		if t, ok := keyGenerates[key.Generate]; !ok {
+			verr.addLine(line, "key %q unknown generate %q", key.Name, key.Generate)
+		} else if mongo || isCompositeKey(meta) {
+			verr.addLine(line, "key %q generate is only supported by single mysql key", key.Name)
+		} else if key.Type != t {
+			verr.addLine(line, "key %q generate %s requires type %s", key.Name, key.Generate, t)
+		}
+	}
+}
+
+// 主键在方法参数中的名字，避开go关键字
+func keyParamName(key MetaField) string {
+	name := formatUcfirstName(key.Name)
+	name = strings.ToLower(name[:1]) + name[1:]
+	if token.IsKeyword(name) {
+		name += "Key"
+	}
+	return name
+}
+
+// GetByKey 按主键查询一条记录，联合主键按<key>定义的顺序传参
+func genGetByKeyCode(meta Meta, funcName string) string {
+	var params, wheres []string
+	for _, key := range meta.Keys {
+		params = append(params, keyParamName(key)+" "+getKeyFieldGolangType(meta, key))
+		wheres = append(wheres, fmt.Sprintf("Where%sEqual(%s)", formatUcfirstName(key.Name), keyParamName(key)))
+	}
+	return fmt.Sprintf(`
+// GetByKey 按主键查询一条记录
+func (q *query%s)GetByKey(%s) (*Meta%s, error) {
+	return q.%s.GetOne()
+}
+`, funcName, strings.Join(params, ", "), funcName, strings.Join(wheres, "."))
+}
+
+// 新记录主键为零值时按generate策略生成
+func genKeyGenerateCode(meta Meta, target string) string {
+	if meta.Key.Generate == "" {
+		return ""
+	}
+	key := formatUcfirstName(meta.Key.Name)
+	return fmt.Sprintf("if %s.%s == %s {\n\t\t%s.%s = %s\n\t}", target, key, getKeyZeroValue(meta), target, key, keyGenerateExpr(meta))
+}
+
+// 主键由写入时分配(mongodb的ObjectID、自增、generate策略)，新记录的主键一定为零值，
+// 其他主键由调用方给出，无法通过主键判断记录是否存在
+func isAssignedKey(meta Meta) bool {
+	return meta.Strategy.Storage.Type == "mongodb" || isAutoIncrementKey(meta) || meta.Key.Generate != ""
+}
+
+// Save判断插入还是更新的表达式，调用方给出的主键按主键upsert，由save在更新分支处理
+func genSaveInsertExpr(meta Meta) string {
+	if !isAssignedKey(meta) {
+		return "false"
+	}
+	return "meta." + formatUcfirstName(meta.Key.Name) + " == " + getKeyZeroValue(meta)
+}
+
+// save由调用方决定插入还是更新：插入时写入新记录，更新时按主键更新已存在的记录，主键在路由前生成，可以作为分片字段，
+// mysql没有更新到记录且记录不存在时插入，有版本号时检查版本号
+func genSaveCode(meta Meta, funcName string) string {
+	drive, key := meta.Strategy.Storage.Drive, formatUcfirstName(meta.Key.Name)
+	_, versioned := getVersionField(meta)
+
+	var updateCode, insertCode string
+	if meta.Strategy.Storage.Type == "mongodb" {
+		updateCode = fmt.Sprintf("return %s.Save(meta, &meta.%s, &q.query)", drive, key)
+		insertCode = fmt.Sprintf("if meta.%s == primitive.NilObjectID {\n\t\tmeta.%s = primitive.NewObjectID()\n\t}\n\treturn %s.Save(meta, nil, &q.query)", key, key, drive)
+	} else {
+		// 没有更新到记录时(mysql中值未改变的记录也不计入)按主键确认记录不存在后插入，导入带主键的记录与v0.4.5的mysql.Save一致
+		updateCode = fmt.Sprintf(`query := q.query
+		query.Conditions = %s
+		query.Sets = meta.saveSets()
+		n, err := %s.Update(&query)
+		if err != nil || n > 0 {
+			return err
+		}
+		if n, err = %s.Count(&query); err != nil || n > 0 {
+			return err
+		}`, genKeyConditionsCode(meta), drive, drive)
+		if isAutoIncrementKey(meta) {
+			insertCode = fmt.Sprintf("id, err := %s.Save(meta, &q.query)\n\tif id > 0 {\n\t\tmeta.%s = %s(id)\n\t}\n\treturn err", drive, key, getKeyGolangType(meta))
+		} else {
+			insertCode = fmt.Sprintf("_, err := %s.Save(meta, &q.query)\n\treturn err", drive)
+		}
+	}
+
+	// 调用方给出的单个主键不能为零值，联合主键的零值可能是有效的取值
+	var keyCheck string
+	if !isAssignedKey(meta) && !isCompositeKey(meta) {
+		keyCheck = fmt.Sprintf("if meta.%s == %s {\n\t\treturn errors.New(\"%s.%s: key %s must be set before save\")\n\t}",
+			key, getKeyZeroValue(meta), meta.Module, meta.Name, meta.Key.Name)
+	}
+	if versioned {
+		// 联合主键不支持版本号，这里只有单个主键。记录不存在时插入，存在但版本号不一致时返回ErrStaleObject
+		insert := fmt.Sprintf("_, err = %s.Save(meta, &q.query)\n\treturn err", drive)
+		if meta.Strategy.Storage.Type == "mongodb" {
+			insert = fmt.Sprintf("return %s.Save(meta, nil, &q.query)", drive)
+		}
+		updateCode = fmt.Sprintf("conflict := []%sField{%sField%s}\n\t", funcName, funcName, key) + genUpsertVersionCode(meta, funcName, insert)
+	}
+
+	return fmt.Sprintf(`
+func (q *query%s)save(meta *Meta%s, insert bool) error {
+	if q.err != nil {
+		return q.err
+	}
+	%s
+	%s
+	%s
+	%s
+	%s
+	if !insert {
+		%s
+	}
+	%s
+}
+`, funcName, funcName, genValidateCallCode(meta, false, ""), keyCheck, genKeyGenerateCode(meta, "meta"), genRouteMetaCode(meta), genTouchCode(meta, "meta"), updateCode, insertCode) +
+		genSaveSetsCode(meta, funcName)
+}
+
+// mysql按主键更新记录时写入的字段，ctime只在插入时写入，有版本号时由versionSets写入
+func genSaveSetsCode(meta Meta, funcName string) string {
+	if _, versioned := getVersionField(meta); versioned || meta.Strategy.Storage.Type == "mongodb" {
+		return ""
+	}
+	keys := map[string]bool{}
+	for _, key := range meta.Keys {
+		keys[key.Name] = true
+	}
+	var sets string
+	ctime, _ := getSpTTime(meta.Fields, "ctime")
+	for _, field := range meta.Fields.List {
+		if !keys[field.Name] && field.Name != ctime.Name {
+			sets += fmt.Sprintf("\t\t\"%s\": {meta.%s},\n", field.Name, ucfirst(field.Name))
+		}
+	}
+	return fmt.Sprintf(`
+// saveSets 按主键更新记录时写入的字段
+func (meta *Meta%s)saveSets() map[string][]interface{} {
+	return map[string][]interface{}{
+%s	}
+}
+`, funcName, sets)
+}
+
+// 按主键识别记录的查询条件
+func genKeyConditionsCode(meta Meta) string {
+	var conditions []string
+	for _, key := range meta.Keys {
+		conditions = append(conditions, fmt.Sprintf(`{AndOr:true, Field:"%s", Con:"Equal", Val:meta.%s}`, key.Name, formatUcfirstName(key.Name)))
+	}
+	return "[]play.Condition{" + strings.Join(conditions, ", ") + "}"
+}
@@ -0,0 +1,181 @@
+package meta
+
+import (
+	"strings"
+	"testing"
+)
+
+const testStockXML = `<meta module="shop" name="stock">
+  <key name="sku" type="string"/>
+  <key name="wh" type="int"/>
+  <fields>
+    <field name="qty" type="uint32"/>
+  </fields>
+  <strategy>
+    <storage type="mysql" database="shop" table="stock"/>
+  </strategy>
+</meta>
+`
+
+func TestCompositeKey(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"stock.xml": testStockXML})
+	assertContains(t, sources, "shop_stock.go",
+		"func (q *queryShopStock) GetByKey(sku string, wh int) (*MetaShopStock, error) {",
+		"return q.WhereSkuEqual(sku).WhereWhEqual(wh).GetOne()",
+	)
+}
+
+func TestKeyGenerate(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML, "bill.xml": testShardXML})
+	assertContains(t, sources, "shop_order.go", "newUUID(7)")
+	assertContains(t, sources, "shop_bill.go", "NextSnowflake()")
+	assertDecls(t, sources, "common.go", "NextSnowflake", "newUUID")
+}
+
+func TestOnlyAutoKeyIsAutoIncrement(t *testing.T) {
+	src := strings.Replace(testShardXML, `<key name="id" type="int64" generate="snowflake"/>`, `<key name="id" type="int"/>`, 1)
+	sources := mustGenerate(t, map[string]string{"bill.xml": src})
+	save := funcSource(t, sources, "shop_bill.go", "queryShopBill.save")
+	if !strings.Contains(save, `errors.New("shop.bill: key id must be set before save")`) || strings.Contains(save, "meta.Id = int(id)") {
+		t.Errorf("int key should be set by the caller:\n%s", save)
+	}
+
+	sources = mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML})
+	save = funcSource(t, sources, "shop_user.go", "queryShopUser.save")
+	if !strings.Contains(save, "meta.Id = int(id)") {
+		t.Errorf("auto key should take the inserted id:\n%s", save)
+	}
+}
+
+func TestCheckKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		err  string
+	}{
+		{"auto in composite", strings.Replace(testStockXML, `<key name="wh" type="int"/>`, `<key name="wh" type="auto"/>`, 1),
+			`key "wh" auto increment is not supported in composite key`},
+		{"composite mongodb", strings.Replace(strings.Replace(testStockXML, `type="mysql"`, `type="mongodb"`, 1), `<key name="sku" type="string"/>`, `<key name="_id" type="objectid"/>`, 1),
+			"composite key is only supported by mysql storage"},
+		{"unknown type", strings.Replace(testStockXML, `<key name="sku" type="string"/>`, `<key name="sku" type="float"/>`, 1),
+			`key "sku" type must be one of auto, int, int64, string`},
+		{"unknown generate", strings.Replace(testShardXML, `generate="snowflake"`, `generate="ulid"`, 1),
+			`key "id" unknown generate "ulid"`},
+		{"generate type", strings.Replace(testShardXML, `type="int64" generate="snowflake"`, `type="string" generate="snowflake"`, 1),
+			`key "id" generate snowflake requires type int64`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeMeta("meta.xml", []byte(tt.src))
+			assertError(t, err, tt.err)
+		})
+	}
+}
+
+// Save更新已存在的记录时按主键Update，不使用Upsert，没有更新到记录且记录不存在时插入
+func TestSaveUpdatesByKey(t *testing.T) {
+	const noteXML = `<meta module="audit" name="note">
+  <key name="_id" type="objectid"/>
+  <fields>
+    <field name="text" type="string"/>
+    <field name="version" type="int" version="true"/>
+  </fields>
+  <strategy>
+    <storage type="mongodb" database="audit" table="note"/>
+  </strategy>
+</meta>
+`
+	files := map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML, "stock.xml": testStockXML, "note.xml": noteXML}
+	sources := buildProject(t, files, false, map[string]string{"save_test.go": `package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/leochen2038/play/database/mysql"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSaveByKey(t *testing.T) {
+	mysql.Calls = nil
+	order := &MetaShopOrder{User_id: 1}
+	if err := ShopOrder().Save(order); err != nil || order.Id == "" {
+		t.Fatalf("save new order: %v", err)
+	}
+	order.Amount = 2
+	if err := ShopOrder().Save(order); err != nil {
+		t.Fatal(err)
+	}
+	// 桩驱动的Update和Count总是返回0，记录不存在时插入
+	if want := []string{"Save", "Update", "Count", "Save"}; !reflect.DeepEqual(mysql.Calls, want) {
+		t.Errorf("driver calls = %v, want %v", mysql.Calls, want)
+	}
+
+	store := NewShopStockMemoryStore()
+	defer UseShopStockStore(store)()
+	stock := &MetaShopStock{Sku: "a", Wh: 1, Qty: 1}
+	for qty := uint32(1); qty <= 2; qty++ {
+		stock.Qty = qty
+		if err := ShopStock().Save(stock); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if records := store.Records(); len(records) != 1 || records[0].Qty != 2 {
+		t.Errorf("caller keyed save should insert then update by key: %+v", records)
+	}
+}
+
+// 写入时分配的主键(自增、uuid)由调用方预先给出时，Save插入新记录，例如导入已有的数据
+func TestSavePresetKey(t *testing.T) {
+	orders := NewShopOrderMemoryStore()
+	defer UseShopOrderStore(orders)()
+	order := &MetaShopOrder{Id: "imported", User_id: 1, Amount: 1}
+	if err := ShopOrder().Save(order); err != nil {
+		t.Fatal(err)
+	}
+	order.Amount = 2
+	if err := ShopOrder().Save(order); err != nil {
+		t.Fatal(err)
+	}
+	if records := orders.Records(); len(records) != 1 || records[0].Id != "imported" || records[0].Amount != 2 {
+		t.Errorf("preset uuid should be inserted then updated: %+v", records)
+	}
+
+	users := NewShopUserMemoryStore()
+	defer UseShopUserStore(users)()
+	user := &MetaShopUser{Id: 7, Name: "a", Status: ShopUserStatusActive}
+	if err := ShopUser().Save(user); err != nil {
+		t.Fatal(err)
+	}
+	if records := users.Records(); len(records) != 1 || records[0].Id != 7 {
+		t.Fatalf("preset auto increment key should be inserted: %+v", records)
+	}
+	stale := *user
+	if err := ShopUser().Save(user); err != nil || user.Version != 1 {
+		t.Fatalf("update by version: %v, version %d", err, user.Version)
+	}
+	if err := ShopUser().Save(&stale); err != ErrStaleObject {
+		t.Errorf("save of a stale record = %v, want ErrStaleObject", err)
+	}
+}
+
+func TestSavePresetObjectID(t *testing.T) {
+	notes := NewAuditNoteMemoryStore()
+	defer UseAuditNoteStore(notes)()
+	note := &MetaAuditNote{Id: primitive.NewObjectID(), Text: "a"}
+	if err := AuditNote().Save(note); err != nil {
+		t.Fatal(err)
+	}
+	note.Text = "b"
+	if err := AuditNote().Save(note); err != nil || note.Version != 1 {
+		t.Fatalf("update by version: %v, version %d", err, note.Version)
+	}
+	if records := notes.Records(); len(records) != 1 || records[0].Text != "b" {
+		t.Errorf("preset ObjectID should be inserted then updated: %+v", records)
+	}
+}
+`})
+	if save := funcSource(t, sources, "shop_order.go", "queryShopOrder.save"); strings.Contains(save, "Upsert") {
+		t.Errorf("save should not upsert:\n%s", save)
+	}
+}
@@ -0,0 +1,188 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 通过子<field>定义结构的字段类型：object为嵌入的结构体，array:object为结构体数组，map:object为以string为键的结构体map
+var objectTypes = []string{"object", "array:object", "map:object"}
+
+func isObjectType(field MetaField) bool {
+	if field.Type == "array:object" {
+		return len(field.Fields) > 0
+	}
+	return inStrings(objectTypes, field.Type)
+}
+
+// 旧格式array:{name:type,...}转换为array:object加子字段
+func parseLegacyObject(field MetaField) MetaField {
+	if !strings.HasPrefix(field.Type, "array:{") || !strings.HasSuffix(field.Type, "}") {
+		return field
+	}
+	for _, v := range strings.Split(field.Type[7:len(field.Type)-1], ",") {
+		kv := strings.SplitN(strings.TrimSpace(v), ":", 2)
+		child := MetaField{Name: strings.TrimSpace(kv[0])}
+		if len(kv) == 2 {
+			child.Type = strings.TrimSpace(kv[1])
+		}
+		field.Fields = append(field.Fields, child)
+	}
+	field.Type = "array:object"
+	return field
+}
+
+// 结构字段的go类型依赖生成的结构体名，生成代码前计算好。
+// mysql中结构字段以json存储，顶层的数组和map使用命名类型以便实现Value/Scan
+func prepareObjectFields(fields []MetaField, prefix string, column bool) []MetaField {
+	list := make([]MetaField, 0, len(fields))
+	for _, field := range fields {
+		field = parseLegacyObject(field)
+		if isObjectType(field) {
+			name := prefix + formatUcfirstName(field.Name)
+			field.structName = name
+			field.Fields = prepareObjectFields(field.Fields, name, false)
+			switch field.Type {
+			case "object":
+				field.goType = name
+			case "array:object":
+				field.goType = "[]" + name
+				if column {
+					field.goType = name + "List"
+				}
+			case "map:object":
+				field.goType = "map[string]" + name
+				if column {
+					field.goType = name + "Map"
+				}
+			}
+		}
+		list = append(list, field)
+	}
+	return list
+}
+
+func checkObjectFields(meta Meta) error {
+	funcName := formatUcfirstName(meta.Module) + formatUcfirstName(meta.Name)
+	names := map[string]string{"Meta" + funcName: meta.Module + "." + meta.Name}
+	var walk func(fields []MetaField, path string) error
+	walk = func(fields []MetaField, path string) error {
+		for _, field := range fields {
+			if field.structName == "" {
+				continue
+			}
+			for _, name := range []string{field.structName, field.structName + "List", field.structName + "Map"} {
+				if prev, ok := names[name]; ok {
+					return errors.New("field " + path + field.Name + " generates type " + name + " which conflicts with " + prev)
+				}
+				names[name] = path + field.Name
+			}
+			if err := walk(field.Fields, path+field.Name+"."); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	column := meta.Strategy.Storage.Type != "mongodb"
+	fields := prepareObjectFields(meta.Fields.List, "Meta"+funcName, column)
+	for _, field := range fields {
+		if !column || field.Type != "object" {
+			continue
+		}
+		for _, child := range field.Fields {
+			if name := ucfirst(child.Name); name == "Value" || name == "Scan" {
+				return errors.New("field " + field.Name + " child " + child.Name + " conflicts with method " + name + " of json column")
+			}
+		}
+	}
+	return walk(fields, "")
+}
+
+// 校验子字段的定义，子字段不支持时间、版本号等只对顶层字段有意义的属性
+func checkChildFields(field MetaField, line int, verr *validateErrors) {
+	field = parseLegacyObject(field)
+	if !isObjectType(field) {
+		if len(field.Fields) > 0 {
+			verr.addLine(line, "field %q child fields are only supported by %s", field.Name, strings.Join(objectTypes, ", "))
+		}
+		return
+	}
+	if len(field.Fields) == 0 {
+		verr.addLine(line, "field %q type %s requires child fields", field.Name, field.Type)
+	}
+
+	names := map[string]bool{}
+	for _, child := range field.Fields {
+		if !isExportedIdent(ucfirst(child.Name)) || !isExportedIdent(formatUcfirstName(child.Name)) {
+			verr.addLine(line, "field %q child %q is not a valid go identifier", field.Name, child.Name)
+		}
+		if names[ucfirst(child.Name)] {
+			verr.addLine(line, "field %q duplicate child %q", field.Name, child.Name)
+		}
+		names[ucfirst(child.Name)] = true
+		if child.Type == "" {
+			verr.addLine(line, "field %q child %q missing type", field.Name, child.Name)
+		} else if !isKnownType(child) {
+			verr.addLine(line, "field %q child %q unknown type %q", field.Name, child.Name, child.Type)
+		}
+		if isTimeType(child.Type) || isEnumType(child.Type) || child.Unit != "" || child.Version || child.Generate != "" || child.Default != "" || hasRules(child) {
+			verr.addLine(line, "field %q child %q does not support time and enum types, unit, version, generate, default or rules", field.Name, child.Name)
+		}
+		checkChildFields(child, line, verr)
+	}
+}
+
+// 结构字段生成的结构体，mysql的顶层结构字段实现driver.Valuer和sql.Scanner，以json格式读写
+func genObjectTypes(fields []MetaField, mongo bool, column bool) (code string) {
+	for _, field := range fields {
+		if field.structName == "" {
+			continue
+		}
+		code += fmt.Sprintf("\ntype %s struct {\n", field.structName)
+		for _, child := range field.Fields {
+			if mongo {
+				code += fmt.Sprintf("\t%s %s\t `bson:\"%s\"", ucfirst(child.Name), getFieldGolangType(child), child.Name)
+				if child.Alias != "" {
+					code += fmt.Sprintf(" json:\"%s\"", child.Alias)
+				}
+				code += "`\n"
+			} else {
+				code += fmt.Sprintf("\t%s %s\t `json:\"%s\"`\n", ucfirst(child.Name), getFieldGolangType(child), child.Name)
+			}
+		}
+		code += "}\n"
+
+		if !mongo && column {
+			if field.Type == "array:object" {
+				code += fmt.Sprintf("\ntype %s []%s\n", field.goType, field.structName)
+			} else if field.Type == "map:object" {
+				code += fmt.Sprintf("\ntype %s map[string]%s\n", field.goType, field.structName)
+			}
+			code += genJSONColumnCode(field.goType)
+		}
+		code += genObjectTypes(field.Fields, mongo, false)
+	}
+	return
+}
+
+func genJSONColumnCode(name string) string {
+	return fmt.Sprintf(`
+func (v %s) Value() (driver.Value, error) {
+	return json.Marshal(v)
+}
+
+func (v *%s) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(data, v)
+	case string:
+		return json.Unmarshal([]byte(data), v)
+	}
+	return errors.New("%s: unsupported column type")
+}
+`, name, name, name)
+}
@@ -0,0 +1,49 @@
+package meta
+
+import (
+	"strings"
+	"testing"
+)
+
+const testNestedXML = `<meta module="shop" name="stock">
+  <key name="id" type="auto"/>
+  <fields>
+    <field name="items" type="array:object">
+      <field name="n" type="string"/>
+      <field name="meta" type="map:object">
+        <field name="k" type="int"/>
+      </field>
+    </field>
+    <field name="legacy" type="array:{a:int, b:string}"/>
+  </fields>
+  <strategy>
+    <storage type="mysql" database="shop" table="stock"/>
+  </strategy>
+</meta>
+`
+
+func TestNestedObjectTypes(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML, "stock.xml": testNestedXML})
+	assertDecls(t, sources, "shop_order.go", "MetaShopOrderAddr", "MetaShopOrderAddr.Value", "MetaShopOrderAddr.Scan")
+	assertContains(t, sources, "shop_order.go", "Addr    MetaShopOrderAddr `db:\"addr\"`")
+
+	assertDecls(t, sources, "shop_stock.go", "MetaShopStockItems", "MetaShopStockItemsList", "MetaShopStockItemsMeta", "MetaShopStockLegacy", "MetaShopStockLegacyList")
+	assertContains(t, sources, "shop_stock.go", "Meta map[string]MetaShopStockItemsMeta `json:\"meta\"`")
+}
+
+func TestCheckChildFields(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		err  string
+	}{
+		{`<field name="k" type="int"/>`, `<field name="k" type="int"/><field name="k" type="string"/>`, `stock.xml:4: field "meta" duplicate child "k"`},
+		{`<field name="k" type="int"/>`, `<field name="k" type="ctime"/>`, `field "meta" child "k" does not support time and enum types`},
+		{`<field name="n" type="string"/>`, `<field name="n" type="string" default="x"/>`, `field "items" child "n" does not support`},
+		{`<field name="legacy" type="array:{a:int, b:string}"/>`, `<field name="legacy" type="object"/>`, `field "legacy" type object requires child fields`},
+	}
+	for _, tt := range tests {
+		_, err := decodeMeta("stock.xml", []byte(strings.Replace(testNestedXML, tt.from, tt.to, 1)))
+		assertError(t, err, tt.err)
+	}
+}
@@ -0,0 +1,278 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"github.com/leochen2038/goplay/reconst/env"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// meta通过package属性生成到library/db/<package>下的独立包，未设置时生成到library/db(package db)
+// 共享的运行时只生成在library/db中，其他包import它，因此library/db中的meta不能关联其他包中的meta
+var packageExp = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+
+// 每个包中已生成的文件和顶层声明，用于发现不同meta之间的命名冲突
+var packageFiles = map[string]map[string]string{}
+var packageDecls = map[string]map[string]string{}
+
+func metaPackage(meta Meta) string {
+	if meta.Package == "" {
+		return "db"
+	}
+	return meta.Package
+}
+
+func packageDir(pkg string) string {
+	if pkg == "db" {
+		return env.ProjectPath + "/library/db"
+	}
+	return env.ProjectPath + "/library/db/" + pkg
+}
+
+func packagePath(pkg string) string {
+	if pkg == "db" {
+		return env.ModuleName + "/library/db"
+	}
+	return env.ModuleName + "/library/db/" + pkg
+}
+
+// 共享运行时中的导出名字，在其他包中通过db.引用
+func runtimeName(meta Meta, name string) string {
+	if metaPackage(meta) == "db" {
+		return name
+	}
+	return "db." + name
+}
+
+// 引用其他包中的meta时加上包名
+func qualifiedName(meta Meta, target Meta, name string) string {
+	if metaPackage(meta) == metaPackage(target) {
+		return name
+	}
+	return metaPackage(target) + "." + name
+}
+
+// 关联的meta在其他包时需要import对应的包
+func relationImports(meta Meta) (imports []string) {
+	for _, relation := range meta.Relations.List {
+		target, _ := getRelationMeta(relation)
+		if pkg := metaPackage(target); pkg != metaPackage(meta) && !inStrings(imports, `"`+packagePath(pkg)+`"`) {
+			imports = append(imports, `"`+packagePath(pkg)+`"`)
+		}
+	}
+	return
+}
+
+func checkPackage(meta Meta) error {
+	if meta.Package != "" && (!packageExp.MatchString(meta.Package) || token.IsKeyword(meta.Package)) {
+		return errors.New("package " + meta.Package + " must be a lowercase go identifier")
+	}
+
+	// 关联形成的包之间不能循环import
+	var visit func(pkg string, path []string) error
+	visit = func(pkg string, path []string) error {
+		if inStrings(path, pkg) {
+			return errors.New("relations cause an import cycle between packages " + strings.Join(append(path, pkg), " -> "))
+		}
+		for _, m := range metas {
+			if metaPackage(m) != pkg {
+				continue
+			}
+			for _, relation := range m.Relations.List {
+				if target, ok := getRelationMeta(relation); ok && metaPackage(target) != pkg {
+					if err := visit(metaPackage(target), append(path, pkg)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	}
+	for _, relation := range meta.Relations.List {
+		target, ok := getRelationMeta(relation)
+		// 其他包都import了library/db中的共享运行时，db中的meta不能再引用其他包
+		if ok && metaPackage(meta) == "db" && metaPackage(target) != "db" {
+			return errors.New("relation " + relation.Name + " can not reference " + target.Module + "." + target.Name +
+				" in package " + metaPackage(target) + ", metas in library/db can only reference metas in the same package")
+		}
+		if ok && metaPackage(target) != metaPackage(meta) {
+			if err := visit(metaPackage(target), []string{metaPackage(meta)}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 记录生成的文件、顶层声明和方法，同一个包中出现重复时返回错误
+func checkDecls(pkg string, owner string, filename string, src string) error {
+	if packageFiles[pkg] == nil {
+		packageFiles[pkg], packageDecls[pkg] = map[string]string{}, map[string]string{}
+	}
+	if prev, ok := packageFiles[pkg][filename]; ok {
+		return errors.New(owner + " generates file " + filename + " which conflicts with " + prev)
+	}
+	packageFiles[pkg][filename] = owner
+
+	file, err := parser.ParseFile(token.NewFileSet(), filename, src, 0)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				names = append(names, d.Name.Name)
+			} else {
+				names = append(names, recvTypeName(d.Recv)+"."+d.Name.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					names = append(names, s.Name.Name)
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						names = append(names, name.Name)
+					}
+				}
+			}
+		}
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		if name == "_" {
+			continue
+		}
+		if seen[name] {
+			return errors.New(owner + " declares " + name + " more than once in " + filename)
+		}
+		seen[name] = true
+		if prev, ok := packageDecls[pkg][name]; ok && prev != owner {
+			return errors.New(owner + " declares " + name + " which conflicts with " + prev + " in package " + pkg)
+		}
+		packageDecls[pkg][name] = owner
+	}
+	return nil
+}
+
+// 方法以接收者类型名.方法名记录，与同名的函数和类型区分
+func recvTypeName(recv *ast.FieldList) string {
+	expr := recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// 生成的文件以此开头，删除过期文件时只删除带有该标记的文件
+const generatedHeader = "// Code generated by reconst. DO NOT EDIT.\n\n"
+
+func writeSource(pkg string, owner string, filename string, src string) (err error) {
+	if err = checkDecls(pkg, owner, filename, src); err != nil {
+		return
+	}
+	src = generatedHeader + src
+	if err = os.MkdirAll(packageDir(pkg), 0744); err != nil {
+		return
+	}
+	filePath := packageDir(pkg) + "/" + filename
+	if err = ioutil.WriteFile(filePath, []byte(src), 0644); err != nil {
+		return
+	}
+	exec.Command(runtime.GOROOT()+"/bin/gofmt", "-w", filePath).Run()
+	return
+}
+
+// 删除之前生成而本次没有生成的文件，例如meta被删除或改变了package，手写的文件没有生成标记不会被删除
+func removeStaleSources() error {
+	root := packageDir("db")
+	dirs := map[string]string{root: "db"}
+	infos, err := ioutil.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, fi := range infos {
+		if fi.IsDir() {
+			dirs[root+"/"+fi.Name()] = fi.Name()
+		}
+	}
+	for dir, pkg := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, fi := range files {
+			if _, ok := packageFiles[pkg][fi.Name()]; ok || fi.IsDir() || !strings.HasSuffix(fi.Name(), ".go") {
+				continue
+			}
+			data, err := ioutil.ReadFile(dir + "/" + fi.Name())
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(string(data), generatedHeader) {
+				if err = os.Remove(dir + "/" + fi.Name()); err != nil {
+					return err
+				}
+			}
+		}
+		// 不再有meta的包目录为空时一起删除
+		if dir != root && packageFiles[pkg] == nil {
+			os.Remove(dir)
+		}
+	}
+	return nil
+}
+
+// 每个包生成index.go，列出包中所有的meta
+func genPackageIndexCode(pkg string, list []Meta) string {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Module+"."+list[i].Name < list[j].Module+"."+list[j].Name
+	})
+	var items string
+	for _, meta := range list {
+		items += fmt.Sprintf("\t%q: {Module: %q, Name: %q, Storage: %q, Database: %q, Table: %q},\n", meta.Module+"."+meta.Name,
+			meta.Module, meta.Name, meta.Strategy.Storage.Type, meta.Strategy.Storage.Database, meta.Strategy.Storage.Table)
+	}
+	return fmt.Sprintf(`package %s
+
+// MetaInfo meta的存储信息
+type MetaInfo struct {
+	Module   string
+	Name     string
+	Storage  string
+	Database string
+	Table    string
+}
+
+// Metas 本包中生成的所有meta，以module.name为键
+var Metas = map[string]MetaInfo{
+%s}
+`, pkg, items)
+}
+
+func writePackageIndexes(list []Meta) error {
+	packages := map[string][]Meta{}
+	for _, meta := range list {
+		packages[metaPackage(meta)] = append(packages[metaPackage(meta)], meta)
+	}
+	for pkg, list := range packages {
+		if err := writeSource(pkg, "index", "index.go", genPackageIndexCode(pkg, list)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
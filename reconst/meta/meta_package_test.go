@@ -0,0 +1,110 @@
+package meta
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// shop.user留在library/db，shop.order生成到library/db/sales
+func testPackageMetas() map[string]string {
+	user := strings.Replace(testUserXML, `<relation name="orders" type="hasMany" module="shop" meta="order" foreign="user_id"/>`, ``, 1)
+	order := strings.Replace(testOrderXML, `<meta module="shop" name="order">`, `<meta module="shop" name="order" package="sales">`, 1)
+	return map[string]string{"user.xml": user, "order.xml": order, "log.xml": testLogXML}
+}
+
+func TestPerMetaPackages(t *testing.T) {
+	sources := mustGenerate(t, testPackageMetas())
+	for _, filename := range []string{"common.go", "index.go", "shop_user.go", "sales/common.go", "sales/index.go", "sales/shop_order.go"} {
+		if _, ok := sources[filename]; !ok {
+			t.Errorf("%s is not generated", filename)
+		}
+	}
+	if _, ok := sources["shop_order.go"]; ok {
+		t.Error("shop_order.go should not be generated in library/db")
+	}
+	assertContains(t, sources, "sales/shop_order.go", "package sales\n", `"proj/library/db"`, "db.MetaShopUser")
+	assertContains(t, sources, "sales/index.go", `"shop.order": {Module: "shop", Name: "order"`)
+}
+
+func TestSharedRuntimeGeneratedOnce(t *testing.T) {
+	sources := mustGenerate(t, testPackageMetas())
+	shared := []string{"Tx", "AfterCommit", "NextSnowflake", "RedisCache", "NewDecimal", "Decimal.Add", "JSON.Scan", "ErrStaleObject", "ErrDuplicateKey"}
+	assertDecls(t, sources, "common.go", shared...)
+	assertDecls(t, sources, "sales/common.go", "Decimal", "JSON", "Cache", "ValidationErrors", "BeforeSaver", "ErrStaleObject", "ErrDuplicateKey")
+	assertNoDecls(t, sources, "sales/common.go", "Tx", "AfterCommit", "NextSnowflake", "RedisCache", "NewDecimal", "Decimal.Add", "JSON.Scan")
+	assertContains(t, sources, "sales/common.go", "Decimal          = db.Decimal", "ErrStaleObject  = db.ErrStaleObject")
+	// 有mongodb meta时Decimal的bson编解码只在db中生成一次
+	assertDecls(t, sources, "common.go", "Decimal.MarshalBSONValue")
+	assertNoDecls(t, sources, "sales/common.go", "Decimal.MarshalBSONValue")
+}
+
+func TestCheckPackage(t *testing.T) {
+	metas := testPackageMetas()
+	metas["order.xml"] = strings.Replace(metas["order.xml"], `package="sales"`, `package="Sales"`, 1)
+	_, err := generateProject(t, metas)
+	assertError(t, err, "package Sales must be a lowercase go identifier")
+
+	// db中的meta不能引用子包中的meta
+	metas = testPackageMetas()
+	metas["user.xml"] = testUserXML
+	metas["order.xml"] = strings.Replace(metas["order.xml"], `<relation name="user" type="belongsTo" module="shop" meta="user" foreign="user_id"/>`, ``, 1)
+	_, err = generateProject(t, metas)
+	assertError(t, err, "relation orders can not reference shop.order in package sales, metas in library/db can only reference metas in the same package")
+
+	metas = testPackageMetas()
+	metas["user.xml"] = strings.Replace(testUserXML, `<meta module="shop" name="user">`, `<meta module="shop" name="user" package="members">`, 1)
+	_, err = generateProject(t, metas)
+	assertError(t, err, "relations cause an import cycle between packages")
+}
+
+func TestCheckDecls(t *testing.T) {
+	packageFiles, packageDecls = map[string]map[string]string{}, map[string]map[string]string{}
+	if err := checkDecls("db", "shop.user", "shop_user.go", "package db\ntype A struct{}\nfunc (A) Get() {}\nfunc Get() {}\n"); err != nil {
+		t.Fatal(err)
+	}
+	assertError(t, checkDecls("db", "shop.user", "shop_user.go", "package db\n"), "shop.user generates file shop_user.go which conflicts with shop.user")
+	assertError(t, checkDecls("db", "shop.order", "shop_order.go", "package db\nfunc Get() {}\n"), "shop.order declares Get which conflicts with shop.user in package db")
+	assertError(t, checkDecls("db", "shop.item", "shop_item.go", "package db\ntype B struct{}\nfunc (B) Get() {}\nfunc (*B) Get() {}\n"), "shop.item declares B.Get more than once in shop_item.go")
+	if err := checkDecls("sales", "shop.order", "shop_order.go", "package sales\nfunc Get() {}\n"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 同一进程中再次生成不会与上一次冲突，meta改变package后删除之前生成的文件，手写的文件保留
+func TestRegenerateRemovesStaleFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := generateIn(t, dir, testPackageMetas()); err != nil {
+		t.Fatal(err)
+	}
+	hooks := dir + "/library/db/sales/hooks.go"
+	if err := ioutil.WriteFile(hooks, []byte("package sales\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	order := strings.Replace(testPackageMetas()["order.xml"], `package="sales"`, `package="billing"`, 1)
+	if err := ioutil.WriteFile(dir+"/assets/meta/order.xml", []byte(order), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := MetaGenerator(); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	for _, filename := range []string{"sales/shop_order.go", "sales/common.go", "sales/index.go"} {
+		if _, err := os.Stat(dir + "/library/db/" + filename); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed", filename)
+		}
+	}
+	for _, filename := range []string{"billing/shop_order.go", "shop_user.go", "sales/hooks.go"} {
+		if _, err := os.Stat(dir + "/library/db/" + filename); err != nil {
+			t.Errorf("%s should exist: %v", filename, err)
+		}
+	}
+}
+
+// 生成的全部测试meta对照提供全部接口的框架桩通过go vet
+func TestGeneratedCodeVets(t *testing.T) {
+	files := testPackageMetas()
+	files["stock.xml"] = testTypesXML
+	files["bill.xml"] = testShardXML
+	buildProject(t, files, false, nil)
+}
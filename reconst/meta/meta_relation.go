@@ -0,0 +1,261 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// belongsTo: 本meta的foreign字段关联目标meta的主键
+// hasMany: 目标meta的foreign字段关联本meta的主键
+var relationTypes = []string{"belongsTo", "hasMany"}
+
+func getRelationMeta(relation MetaRelation) (Meta, bool) {
+	meta, ok := metas[relation.Module+"."+relation.Meta]
+	return meta, ok
+}
+
+func getMetaField(meta Meta, name string) (MetaField, bool) {
+	for _, field := range meta.Fields.List {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return MetaField{}, false
+}
+
+// 查询上已有的With方法，关联生成的With<Name>不能与之重名
+var reservedRelationNames = []string{"Tx", "Trashed"}
+
+func checkRelations(meta Meta) error {
+	names := map[string]bool{}
+	for _, key := range meta.Keys {
+		names[formatUcfirstName(key.Name)] = true
+	}
+	for _, field := range meta.Fields.List {
+		names[ucfirst(field.Name)] = true
+	}
+
+	for _, relation := range meta.Relations.List {
+		goName := formatUcfirstName(relation.Name)
+		if !isExportedIdent(goName) {
+			return errors.New("relation name " + relation.Name + " is not a valid go identifier")
+		}
+		if names[goName] {
+			return errors.New("relation " + relation.Name + " conflicts with field " + goName)
+		}
+		if inStrings(reservedMetaNames, goName) {
+			return errors.New("relation " + relation.Name + " conflicts with the generated method " + goName)
+		}
+		if inStrings(reservedRelationNames, goName) {
+			return errors.New("relation " + relation.Name + " conflicts with the generated query method With" + goName)
+		}
+		names[goName] = true
+
+		if !inStrings(relationTypes, relation.Type) {
+			return errors.New("relation " + relation.Name + " unknown type " + relation.Type)
+		}
+		target, ok := getRelationMeta(relation)
+		if !ok {
+			return errors.New("relation " + relation.Name + " can not find meta " + relation.Module + "." + relation.Meta)
+		}
+
+		var foreignMeta, keyMeta Meta
+		if relation.Type == "belongsTo" {
+			foreignMeta, keyMeta = meta, target
+		} else {
+			foreignMeta, keyMeta = target, meta
+		}
+		if isCompositeKey(keyMeta) {
+			return errors.New("relation " + relation.Name + " can not reference composite key of " + keyMeta.Module + "." + keyMeta.Name)
+		}
+		foreign, ok := getMetaField(foreignMeta, relation.Foreign)
+		if !ok {
+			return errors.New("relation " + relation.Name + " can not find field " + relation.Foreign + " in " + foreignMeta.Module + "." + foreignMeta.Name)
+		}
+		if getFieldGolangType(foreign) != getKeyGolangType(keyMeta) {
+			return errors.New("relation " + relation.Name + " field " + relation.Foreign + " type " + getFieldGolangType(foreign) +
+				" does not match key type " + getKeyGolangType(keyMeta) + " of " + keyMeta.Module + "." + keyMeta.Name)
+		}
+		// 分片的目标meta按分片分组加载，分片字段只能是关联字段
+		if route, ok := getRoute(target); ok && len(route.Rules) > 0 {
+			if relation.Type == "belongsTo" {
+				return errors.New("relation " + relation.Name + " can not load sharded meta " + target.Module + "." + target.Name + " by key")
+			}
+			for _, field := range routeFields(route) {
+				if field != relation.Foreign {
+					return errors.New("relation " + relation.Name + " can not load meta " + target.Module + "." + target.Name +
+						" sharded by " + field + ", shard field must be the foreign field " + relation.Foreign)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Meta结构体中存放关联数据的字段，不参与存储
+func genRelationFields(meta Meta) (code string) {
+	for _, relation := range meta.Relations.List {
+		target, _ := getRelationMeta(relation)
+		targetName := qualifiedName(meta, target, "Meta"+formatUcfirstName(target.Module)+formatUcfirstName(target.Name))
+		if relation.Type == "belongsTo" {
+			code += fmt.Sprintf("\t%s *%s\t `db:\"-\" bson:\"-\" json:\"%s,omitempty\"`\n", formatUcfirstName(relation.Name), targetName, relation.Name)
+		} else {
+			code += fmt.Sprintf("\t%s []%s\t `db:\"-\" bson:\"-\" json:\"%s,omitempty\"`\n", formatUcfirstName(relation.Name), targetName, relation.Name)
+		}
+	}
+	return
+}
+
+func genRelationQueryFields(meta Meta) (code string) {
+	for _, relation := range meta.Relations.List {
+		code += "\twith" + formatUcfirstName(relation.Name) + " bool\n"
+	}
+	return
+}
+
+// GetOne/GetList查询完成后加载关联数据的代码片段
+func genRelationLoadCode(meta Meta, funcName string, list bool) string {
+	if len(meta.Relations.List) == 0 {
+		return ""
+	}
+	if !list {
+		return `if err := q.loadRelations(meta); err != nil {
+		return nil, err
+	}`
+	}
+	return fmt.Sprintf(`if err == nil && len(list) > 0 {
+		metas := make([]*Meta%s, len(list))
+		for i := range list {
+			metas[i] = &list[i]
+		}
+		err = q.loadRelations(metas...)
+	}`, funcName)
+}
+
+func genRelationCode(meta Meta, funcName string) (code string) {
+	if len(meta.Relations.List) == 0 {
+		return
+	}
+
+	var loaders string
+	for _, relation := range meta.Relations.List {
+		target, _ := getRelationMeta(relation)
+		targetName := qualifiedName(meta, target, formatUcfirstName(target.Module)+formatUcfirstName(target.Name))
+		targetType := qualifiedName(meta, target, "Meta"+formatUcfirstName(target.Module)+formatUcfirstName(target.Name))
+		relationName := formatUcfirstName(relation.Name)
+
+		code += fmt.Sprintf(`
+// With%s 查询时通过一次额外的查询批量加载%s
+func (q *query%s)With%s() *query%s {
+	q.with%s = true
+	return q
+}
+`, relationName, relation.Name, funcName, relationName, funcName, relationName)
+
+		if relation.Type == "belongsTo" {
+			foreign, _ := getMetaField(meta, relation.Foreign)
+			keyType := getKeyGolangType(target)
+			loaders += fmt.Sprintf(`
+	if q.with%s {
+		keys := make([]%s, 0, len(metas))
+		for _, meta := range metas {
+			keys = append(keys, meta.%s)
+		}
+		%s
+		if err != nil {
+			return err
+		}
+		index := make(map[%s]*%s, len(related))
+		for i := range related {
+			index[related[i].%s] = &related[i]
+		}
+		for _, meta := range metas {
+			meta.%s = index[meta.%s]
+		}
+	}
+`, relationName, keyType, ucfirst(foreign.Name),
+				genRelationListCode(meta, target, "related", targetName+"().Where"+formatUcfirstName(target.Key.Name)+"In(keys)", "\t\t"),
+				keyType, targetType, formatUcfirstName(target.Key.Name), relationName, ucfirst(foreign.Name))
+		} else {
+			foreign, _ := getMetaField(target, relation.Foreign)
+			keyType := getKeyGolangType(meta)
+			loadCode := fmt.Sprintf(`keys := make([]%s, 0, len(metas))
+		for _, meta := range metas {
+			keys = append(keys, meta.%s)
+		}
+		%s
+		if err != nil {
+			return err
+		}`, keyType, formatUcfirstName(meta.Key.Name), genRelationListCode(meta, target, "related", targetName+"().Where"+ucfirst(foreign.Name)+"In(keys)", "\t\t"))
+			if shard := genRelationShardExpr(target, foreign); shard != "" {
+				loadCode = fmt.Sprintf(`groups := map[string][]%s{}
+		for _, meta := range metas {
+			v := meta.%s
+			shard := %s
+			groups[shard] = append(groups[shard], v)
+		}
+		var related []%s
+		for _, keys := range groups {
+			%s
+			if err != nil {
+				return err
+			}
+			related = append(related, list...)
+		}`, keyType, formatUcfirstName(meta.Key.Name), shard, targetType,
+					genRelationListCode(meta, target, "list", targetName+"().Where"+ucfirst(foreign.Name)+"In(keys)", "\t\t\t"))
+			}
+			loaders += fmt.Sprintf(`
+	if q.with%s {
+		%s
+		index := make(map[%s][]%s, len(metas))
+		for _, v := range related {
+			index[v.%s] = append(index[v.%s], v)
+		}
+		for _, meta := range metas {
+			meta.%s = index[meta.%s]
+		}
+	}
+`, relationName, loadCode, keyType, targetType, ucfirst(foreign.Name), ucfirst(foreign.Name), relationName, formatUcfirstName(meta.Key.Name))
+		}
+	}
+
+	code += fmt.Sprintf(`
+func (q *query%s)loadRelations(metas ...*Meta%s) error {%s
+	return nil
+}
+`, funcName, funcName, loaders)
+	return
+}
+
+// 关联查询使用当前查询的事务，不同存储的事务无法共用
+func genRelationListCode(meta Meta, target Meta, related string, query string, indent string) string {
+	storage := meta.Strategy.Storage.Type
+	if !hasTx(target) || storage != target.Strategy.Storage.Type {
+		return fmt.Sprintf("%s, err := %s.GetList()", related, query)
+	}
+	txType := "*sql.Tx"
+	if storage == "mongodb" {
+		txType = "mongo.SessionContext"
+	}
+	return strings.Join([]string{
+		"rq := " + query,
+		"if tx, ok := q.query.Tx.(" + txType + "); ok {",
+		"\trq.WithTx(tx)",
+		"}",
+		related + ", err := rq.GetList()",
+	}, "\n"+indent)
+}
+
+// 分片的目标meta按关联字段的值v计算所在分片的表达式，同一分片的记录通过一次In查询加载，未分片时返回空
+func genRelationShardExpr(target Meta, foreign MetaField) string {
+	route, ok := getRoute(target)
+	if !ok || len(route.Rules) == 0 {
+		return ""
+	}
+	var exprs []string
+	for _, rule := range route.Rules {
+		exprs = append(exprs, routeSuffixExpr(rule, getFieldGolangType(foreign)))
+	}
+	return strings.Join(exprs, ` + "/" + `)
+}
@@ -0,0 +1,125 @@
+package meta
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRelations(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML})
+	assertDecls(t, sources, "shop_user.go", "queryShopUser.WithOrders", "queryShopUser.loadRelations")
+	assertDecls(t, sources, "shop_order.go", "queryShopOrder.WithUser", "queryShopOrder.loadRelations")
+	assertContains(t, sources, "shop_user.go", "Orders  []MetaShopOrder `db:\"-\" bson:\"-\" json:\"orders,omitempty\"`")
+}
+
+func TestCheckRelations(t *testing.T) {
+	tests := []struct {
+		relation string
+		err      string
+	}{
+		{`<relation name="orders" type="hasOne" module="shop" meta="order" foreign="user_id"/>`, "relation orders unknown type hasOne"},
+		{`<relation name="orders" type="hasMany" module="shop" meta="cart" foreign="user_id"/>`, "relation orders can not find meta shop.cart"},
+		{`<relation name="orders" type="hasMany" module="shop" meta="order" foreign="uid"/>`, "relation orders can not find field uid in shop.order"},
+		{`<relation name="age" type="hasMany" module="shop" meta="order" foreign="user_id"/>`, "relation age conflicts with field Age"},
+		{`<relation name="tx" type="hasMany" module="shop" meta="order" foreign="user_id"/>`, "conflicts with the generated query method WithTx"},
+		{`<relation name="trashed" type="hasMany" module="shop" meta="order" foreign="user_id"/>`, "conflicts with the generated query method WithTrashed"},
+	}
+	for _, tt := range tests {
+		src := strings.Replace(testUserXML, `<relation name="orders" type="hasMany" module="shop" meta="order" foreign="user_id"/>`, tt.relation, 1)
+		_, err := generateProject(t, map[string]string{"user.xml": src, "order.xml": testOrderXML})
+		assertError(t, err, tt.err)
+	}
+
+	mismatch := strings.Replace(testOrderXML, `<field name="user_id" type="int"/>`, `<field name="user_id" type="string"/>`, 1)
+	_, err := generateProject(t, map[string]string{"user.xml": testUserXML, "order.xml": mismatch})
+	assertError(t, err, "field user_id type string does not match key type int of shop.user")
+}
+
+const testTopicXML = `<meta module="forum" name="topic">
+  <key name="_id" type="objectid"/>
+  <fields>
+    <field name="title" type="string"/>
+  </fields>
+  <strategy>
+    <storage type="mongodb" database="forum" table="topic"/>
+  </strategy>
+  <relations>
+    <relation name="replies" type="hasMany" module="forum" meta="reply" foreign="topic_id"/>
+  </relations>
+</meta>
+`
+
+const testReplyXML = `<meta module="forum" name="reply">
+  <key name="_id" type="objectid"/>
+  <fields>
+    <field name="topic_id" type="objectid" required="true"/>
+    <field name="body" type="string"/>
+  </fields>
+  <strategy>
+    <storage type="mongodb" database="forum" table="reply"/>
+  </strategy>
+  <relations>
+    <relation name="topic" type="belongsTo" module="forum" meta="topic" foreign="topic_id"/>
+  </relations>
+</meta>
+`
+
+func TestObjectIDRelations(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"topic.xml": testTopicXML, "reply.xml": testReplyXML})
+	assertContains(t, sources, "forum_reply.go", "Topic_id primitive.ObjectID")
+	assertContains(t, sources, "forum_reply.go", "if tx, ok := q.query.Tx.(mongo.SessionContext); ok {")
+
+	mysql := strings.Replace(testOrderXML, `<field name="amount" type="float"/>`, `<field name="ref" type="objectid"/>`, 1)
+	_, err := generateProject(t, map[string]string{"user.xml": testUserXML, "order.xml": mysql})
+	assertError(t, err, `field "ref" type objectid is only supported by mongodb storage`)
+}
+
+func TestRelationsRun(t *testing.T) {
+	buildProject(t, map[string]string{"topic.xml": testTopicXML, "reply.xml": testReplyXML}, false, map[string]string{"relation_test.go": `package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/leochen2038/play"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type txReplyStore struct {
+	*ForumReplyMemoryStore
+	tx interface{}
+}
+
+func (s *txReplyStore) GetList(list *[]MetaForumReply, query *play.Query) error {
+	s.tx = query.Tx
+	return s.ForumReplyMemoryStore.GetList(list, query)
+}
+
+func TestRelations(t *testing.T) {
+	topic := MetaForumTopic{Id: primitive.NewObjectID(), Title: "a"}
+	other := MetaForumTopic{Id: primitive.NewObjectID(), Title: "b"}
+	defer UseForumTopicStore(NewForumTopicMemoryStore(topic, other))()
+	replies := &txReplyStore{ForumReplyMemoryStore: NewForumReplyMemoryStore(
+		MetaForumReply{Id: primitive.NewObjectID(), Topic_id: topic.Id, Body: "x"},
+		MetaForumReply{Id: primitive.NewObjectID(), Topic_id: topic.Id, Body: "y"},
+		MetaForumReply{Id: primitive.NewObjectID(), Topic_id: other.Id, Body: "z"},
+	)}
+	defer UseForumReplyStore(replies)()
+
+	sc := mongo.NewSessionContext(context.Background(), nil)
+	list, err := ForumTopic().WhereIdEqual(topic.Id).WithReplies().WithTx(sc).GetList()
+	if err != nil || len(list) != 1 || len(list[0].Replies) != 2 {
+		t.Fatalf("WithReplies() = %+v, %v", list, err)
+	}
+	if replies.tx != sc {
+		t.Error("relation loader should use the transaction of the query")
+	}
+
+	reply, err := ForumReply().WhereBodyEqual("z").WithTopic().GetOne()
+	if err != nil || reply.Topic == nil || reply.Topic.Title != "b" {
+		t.Fatalf("WithTopic() = %+v, %v", reply, err)
+	}
+}
+`})
+}
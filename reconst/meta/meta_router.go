@@ -0,0 +1,264 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// router属性作为普通字符串原样传给驱动，分片和读写路由在route属性中声明，格式为以分号分隔的路由规则，
+// 分片字段可以是字段或者主键
+//
+//	table:hash(uid,16)        表名后缀为 uid 哈希后对16取模，如 order_3
+//	database:range(uid,1000000) 库名后缀为 uid/1000000，如 shop_2
+//	read:slave                读操作(GetOne/GetList/Count/聚合)使用的驱动路由
+//	write:master              写操作使用的驱动路由
+type metaRoute struct {
+	Rules []routeRule
+	Read  string
+	Write string
+}
+
+type routeRule struct {
+	Target string // table或database
+	Method string // hash或range
+	Field  string
+	N      int64
+}
+
+var routeRuleExp = regexp.MustCompile(`^(hash|range)\(\s*(\w+)\s*,\s*(\d+)\s*\)$`)
+
+func parseRouter(router string) (route metaRoute, err error) {
+	targets := map[string]bool{}
+	for _, item := range strings.Split(router, ";") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, ":", 2)
+		if len(kv) != 2 {
+			return route, errors.New("route rule " + item + " must be target:rule")
+		}
+		target, rule := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if targets[target] {
+			return route, errors.New("route target " + target + " is duplicated")
+		}
+		targets[target] = true
+
+		switch target {
+		case "read":
+			route.Read = rule
+		case "write":
+			route.Write = rule
+		case "table", "database":
+			m := routeRuleExp.FindStringSubmatch(rule)
+			if m == nil {
+				return route, errors.New("route rule " + item + " must be hash(field,n) or range(field,n)")
+			}
+			n, _ := strconv.ParseInt(m[3], 10, 64)
+			if n <= 0 {
+				return route, errors.New("route rule " + item + " n must be greater than 0")
+			}
+			route.Rules = append(route.Rules, routeRule{Target: target, Method: m[1], Field: m[2], N: n})
+		default:
+			return route, errors.New("route unknown target " + target)
+		}
+	}
+	return
+}
+
+// 分片字段的go类型和在Meta结构体中的字段名，主键也可以作为分片字段
+func getRouteField(meta Meta, name string) (fieldType string, member string, ok bool) {
+	for _, key := range meta.Keys {
+		if key.Name == name {
+			return getKeyFieldGolangType(meta, key), formatUcfirstName(key.Name), true
+		}
+	}
+	if field, ok := getMetaField(meta, name); ok {
+		return getFieldGolangType(field), ucfirst(field.Name), true
+	}
+	return "", "", false
+}
+
+func checkRouter(meta Meta) error {
+	if meta.Strategy.Storage.Route == "" {
+		return nil
+	}
+	route, err := parseRouter(meta.Strategy.Storage.Route)
+	if err != nil {
+		return err
+	}
+	for _, rule := range route.Rules {
+		fieldType, _, ok := getRouteField(meta, rule.Field)
+		if !ok {
+			return errors.New("route shard field " + rule.Field + " is not a key or field of meta")
+		}
+		// 自增主键在写入后才分配，写入时无法确定分片
+		if isAutoIncrementKey(meta) && rule.Field == meta.Key.Name {
+			return errors.New("route shard field " + rule.Field + " can not be an auto increment key")
+		}
+		switch fieldType {
+		case "int", "int64":
+		case "string":
+			if rule.Method == "range" {
+				return errors.New("route range shard field " + rule.Field + " must be int or int64")
+			}
+		default:
+			return errors.New("route shard field " + rule.Field + " must be int, int64 or string")
+		}
+	}
+	return nil
+}
+
+func getRoute(meta Meta) (metaRoute, bool) {
+	if meta.Strategy.Storage.Route == "" {
+		return metaRoute{}, false
+	}
+	route, _ := parseRouter(meta.Strategy.Storage.Route)
+	return route, true
+}
+
+// 构造函数中query.Router的初始值，route中的write覆盖router
+func getDefaultRouter(meta Meta) string {
+	if route, ok := getRoute(meta); ok && route.Write != "" {
+		return route.Write
+	}
+	return meta.Strategy.Storage.Router
+}
+
+// 按分片规则计算后缀的表达式，v为分片字段的值
+func routeSuffixExpr(rule routeRule, fieldType string) string {
+	if rule.Method == "range" {
+		return fmt.Sprintf("strconv.FormatInt(int64(v)/%d, 10)", rule.N)
+	}
+	if fieldType == "string" {
+		return fmt.Sprintf("strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(v))%%%d), 10)", rule.N)
+	}
+	return fmt.Sprintf("strconv.FormatUint(uint64(v)%%%d, 10)", rule.N)
+}
+
+// 分片字段按出现顺序去重
+func routeFields(route metaRoute) (fields []string) {
+	seen := map[string]bool{}
+	for _, rule := range route.Rules {
+		if !seen[rule.Field] {
+			seen[rule.Field] = true
+			fields = append(fields, rule.Field)
+		}
+	}
+	return
+}
+
+// check在每个按条件执行的操作前调用，分片的meta从条件中取分片字段的值计算库表
+func genRouteCode(meta Meta, funcName string) (code string) {
+	route, ok := getRoute(meta)
+	if !ok {
+		return fmt.Sprintf(`
+func (q *query%s)check(read bool) error {
+	return q.err
+}
+`, funcName)
+	}
+
+	var writeCode string
+	if route.Read != "" || route.Write != "" {
+		writeCode = fmt.Sprintf("\n\tq.query.Router = \"%s\"", getDefaultRouter(meta))
+	}
+
+	var routerCode string
+	if route.Read != "" {
+		routerCode = fmt.Sprintf(`
+	if read {
+		q.query.Router = "%s"
+	} else {
+		q.query.Router = "%s"
+	}`, route.Read, getDefaultRouter(meta))
+	} else {
+		routerCode = writeCode
+	}
+
+	var checkCode, metaCode string
+	for _, name := range routeFields(route) {
+		fieldType, member, _ := getRouteField(meta, name)
+
+		var sets string
+		for _, rule := range route.Rules {
+			if rule.Field != name {
+				continue
+			}
+			if rule.Target == "table" {
+				sets += fmt.Sprintf("\tq.query.Table = \"%s_\" + %s\n", meta.Strategy.Storage.Table, routeSuffixExpr(rule, fieldType))
+			} else {
+				sets += fmt.Sprintf("\tq.query.DBName = \"%s_\" + %s\n", meta.Strategy.Storage.Database, routeSuffixExpr(rule, fieldType))
+			}
+		}
+		code += fmt.Sprintf(`
+func (q *query%s)shard%s(v %s) {
+%s}
+`, funcName, ucfirst(name), fieldType, sets)
+
+		checkCode += fmt.Sprintf(`
+	if v, ok := shardValue(q.query.Conditions, "%s").(%s); ok {
+		q.shard%s(v)
+	} else if s, ok := shardValue(q.query.Conditions, "%s").([]%s); ok && len(s) > 0 {
+		q.shard%s(s[0])
+		table, database := q.query.Table, q.query.DBName
+		for _, v := range s[1:] {
+			if q.shard%s(v); q.query.Table != table || q.query.DBName != database {
+				q.err = errors.New("%s.%s: values of shard field %s in an In condition must belong to the same shard")
+				return q.err
+			}
+		}
+	} else {
+		q.err = errors.New("%s.%s: shard field %s must be used with an Equal or In condition")
+		return q.err
+	}`, name, fieldType, ucfirst(name), name, fieldType, ucfirst(name), ucfirst(name), meta.Module, meta.Name, name, meta.Module, meta.Name, name)
+		metaCode += fmt.Sprintf("\n\tq.shard%s(meta.%s)", ucfirst(name), member)
+	}
+
+	code += fmt.Sprintf(`
+// check 从条件中取分片字段的值确定库表，In条件的值必须位于同一个分片，读操作使用读路由
+func (q *query%s)check(read bool) error {
+	if q.err != nil {
+		return q.err
+	}%s%s
+	return nil
+}
+
+// routeMeta 按记录中分片字段的值确定写入的库表
+func (q *query%s)routeMeta(meta *Meta%s) {%s%s
+}
+
+// routeMany 批量写入的记录必须位于同一个分片
+func (q *query%s)routeMany(list []*Meta%s) error {
+	for i, meta := range list {
+		table, database := q.query.Table, q.query.DBName
+		q.routeMeta(meta)
+		if i > 0 && (q.query.Table != table || q.query.DBName != database) {
+			return errors.New("%s.%s: records in one batch must belong to the same shard")
+		}
+	}
+	return nil
+}
+`, funcName, checkCode, routerCode, funcName, funcName, metaCode, writeCode,
+		funcName, funcName, meta.Module, meta.Name)
+	return
+}
+
+// Save/Upsert等按记录写入前的路由代码片段
+func genRouteMetaCode(meta Meta) string {
+	if _, ok := getRoute(meta); !ok {
+		return ""
+	}
+	return "q.routeMeta(meta)"
+}
+
+func genRouteManyCode(meta Meta, zero string) string {
+	if _, ok := getRoute(meta); !ok {
+		return ""
+	}
+	return fmt.Sprintf(`if err := q.routeMany(list); err != nil {
+		return %serr
+	}`, zero)
+}
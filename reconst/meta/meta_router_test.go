@@ -0,0 +1,97 @@
+package meta
+
+import (
+	"strings"
+	"testing"
+)
+
+const testShardXML = `<meta module="shop" name="bill">
+  <key name="id" type="int64" generate="snowflake"/>
+  <fields>
+    <field name="user_id" type="int"/>
+    <field name="region" type="string"/>
+  </fields>
+  <strategy>
+    <storage type="mysql" database="shop" table="bill" route="table:hash(user_id,16);read:slave;write:master"/>
+  </strategy>
+</meta>
+`
+
+func TestShardRouting(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"bill.xml": testShardXML})
+	assertDecls(t, sources, "shop_bill.go", "queryShopBill.shardUser_id", "queryShopBill.routeMeta", "queryShopBill.routeMany")
+	assertContains(t, sources, "shop_bill.go",
+		`q.query.Router = "slave"`,
+		`q.query.Router = "master"`,
+		`errors.New("shop.bill: shard field user_id must be used with an Equal or In condition")`,
+	)
+	assertContains(t, sources, "common.go", "func shardValue(conditions []play.Condition, field string) interface{} {")
+}
+
+func TestPlainRouterName(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML})
+	assertContains(t, sources, "shop_order.go", `obj.query.Router = "hash(user_id,16)"`)
+	assertNoDecls(t, sources, "shop_order.go", "queryShopOrder.routeMeta")
+
+	// 含冒号的router同样原样传给驱动
+	src := strings.Replace(testShardXML, `route="table:hash(user_id,16);read:slave;write:master"`, `router="cluster:main"`, 1)
+	sources = mustGenerate(t, map[string]string{"bill.xml": src})
+	assertContains(t, sources, "shop_bill.go", `obj.query.Router = "cluster:main"`)
+	assertNoDecls(t, sources, "shop_bill.go", "queryShopBill.routeMeta")
+
+	// route只有read时写操作使用router
+	src = strings.Replace(testShardXML, `route="table:hash(user_id,16);read:slave;write:master"`, `router="main" route="read:slave"`, 1)
+	sources = mustGenerate(t, map[string]string{"bill.xml": src})
+	assertContains(t, sources, "shop_bill.go", `obj.query.Router = "main"`, `q.query.Router = "slave"`)
+}
+
+// 主键可以作为分片字段，生成的主键在路由前写入
+func TestShardByKey(t *testing.T) {
+	src := strings.Replace(testShardXML, "table:hash(user_id,16)", "table:hash(id,4)", 1)
+	buildProject(t, map[string]string{"bill.xml": src}, true, map[string]string{"shard_test.go": `package db
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestShardByKey(t *testing.T) {
+	q := ShopBill()
+	bill := &MetaShopBill{User_id: 1}
+	if err := q.Save(bill); err != nil {
+		t.Fatal(err)
+	}
+	table := "bill_" + strconv.FormatInt(bill.Id%4, 10)
+	if bill.Id == 0 || q.query.Table != table {
+		t.Fatalf("save routed to %s, want %s", q.query.Table, table)
+	}
+	q = ShopBill().WhereIdEqual(bill.Id)
+	if err := q.check(true); err != nil || q.query.Table != table {
+		t.Errorf("query routed to %s, %v, want %s", q.query.Table, err, table)
+	}
+}
+`})
+}
+
+func TestCheckRouter(t *testing.T) {
+	tests := []struct {
+		router string
+		err    string
+	}{
+		{"table:hash(uid,16)", "route shard field uid is not a key or field of meta"},
+		{"table:range(region,16)", "route range shard field region must be int or int64"},
+		{"table:hash(user_id,0)", "n must be greater than 0"},
+		{"table:hash(user_id,4);table:hash(user_id,8)", "route target table is duplicated"},
+		{"shard:hash(user_id,4)", "route unknown target shard"},
+	}
+	for _, tt := range tests {
+		src := strings.Replace(testShardXML, "table:hash(user_id,16);read:slave;write:master", tt.router, 1)
+		_, err := generateProject(t, map[string]string{"bill.xml": src})
+		assertError(t, err, tt.err)
+	}
+
+	src := strings.Replace(testShardXML, `<key name="id" type="int64" generate="snowflake"/>`, `<key name="id" type="auto"/>`, 1)
+	src = strings.Replace(src, "table:hash(user_id,16)", "table:hash(id,4)", 1)
+	_, err := generateProject(t, map[string]string{"bill.xml": src})
+	assertError(t, err, "route shard field id can not be an auto increment key")
+}
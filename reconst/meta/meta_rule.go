@@ -0,0 +1,266 @@
+package meta
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 字段的校验规则：required、min/max(数值)、minlen/maxlen(字符串、bytes、数组、map的长度)、pattern、format、oneof
+var ruleFormats = map[string]string{
+	"email": "emailPattern",
+}
+
+func hasRules(field MetaField) bool {
+	return field.Required || field.Min != "" || field.Max != "" || field.MinLen != 0 || field.MaxLen != 0 ||
+		field.Pattern != "" || field.Format != "" || field.OneOf != ""
+}
+
+func isIntType(t string) bool {
+	return t == "int" || t == "int64" || strings.HasPrefix(t, "uint")
+}
+
+func isNumberType(t string) bool {
+	return isIntType(t) || t == "float" || t == "decimal"
+}
+
+// 按字段类型解析规则中的数值，超出类型范围的值会使生成的代码无法编译
+func parseRuleNumber(t string, s string) (*big.Rat, error) {
+	var err error
+	switch {
+	case strings.HasPrefix(t, "uint"):
+		_, err = strconv.ParseUint(s, 10, uintBits[t])
+	case isIntType(t):
+		_, err = strconv.ParseInt(s, 10, intBits[t])
+	case t == "float":
+		_, err = strconv.ParseFloat(s, 64)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if err != nil || !ok || strings.Contains(s, "/") {
+		return nil, fmt.Errorf("%q is not a valid %s", s, t)
+	}
+	return r, nil
+}
+
+func hasLength(field MetaField) bool {
+	t := getFieldGolangType(field)
+	return field.Type == "string" || field.Type == "bytes" || strings.HasPrefix(t, "[]") || strings.HasPrefix(t, "map[")
+}
+
+// Meta上总是生成的方法，字段和关联不能使用同样的名字
+var reservedMetaNames = []string{"Validate", "ValidateFields"}
+
+// mongodb中json字段的go类型为interface{}，无法按长度判断是否为空
+func checkRules(field MetaField, mongo bool, line int, verr *validateErrors) {
+	if !hasRules(field) {
+		return
+	}
+	if field.Required && (isNumberType(field.Type) && field.Type != "decimal" || field.Type == "bool" || isEnumType(field.Type) ||
+		isTimeType(field.Type) || field.Type == "object") {
+		verr.addLine(line, "field %q required is not supported by type %s", field.Name, field.Type)
+	} else if field.Required && mongo && field.Type == "json" {
+		verr.addLine(line, "field %q required is not supported by type json with mongodb storage", field.Name)
+	}
+
+	var min, max *big.Rat
+	var err error
+	if field.Min != "" || field.Max != "" {
+		if !isNumberType(field.Type) {
+			verr.addLine(line, "field %q min and max are only supported by numeric types", field.Name)
+		} else {
+			if field.Min != "" {
+				if min, err = parseRuleNumber(field.Type, field.Min); err != nil {
+					verr.addLine(line, "field %q min %s", field.Name, err.Error())
+				}
+			}
+			if field.Max != "" {
+				if max, err = parseRuleNumber(field.Type, field.Max); err != nil {
+					verr.addLine(line, "field %q max %s", field.Name, err.Error())
+				}
+			}
+			if min != nil && max != nil && min.Cmp(max) > 0 {
+				verr.addLine(line, "field %q min is greater than max", field.Name)
+			}
+		}
+	}
+
+	if field.MinLen != 0 || field.MaxLen != 0 {
+		if !hasLength(field) {
+			verr.addLine(line, "field %q minlen and maxlen are only supported by string, bytes, array and map", field.Name)
+		}
+		if field.MinLen < 0 || field.MaxLen < 0 || field.MaxLen != 0 && field.MinLen > field.MaxLen {
+			verr.addLine(line, "field %q invalid minlen %d or maxlen %d", field.Name, field.MinLen, field.MaxLen)
+		}
+	}
+
+	if field.Pattern != "" || field.Format != "" {
+		if field.Type != "string" {
+			verr.addLine(line, "field %q pattern and format are only supported by string", field.Name)
+		}
+		if _, err := regexp.Compile(field.Pattern); err != nil {
+			verr.addLine(line, "field %q pattern: %s", field.Name, err.Error())
+		}
+		if _, ok := ruleFormats[field.Format]; field.Format != "" && !ok {
+			verr.addLine(line, "field %q unknown format %q", field.Name, field.Format)
+		}
+	}
+
+	if field.OneOf != "" {
+		if field.Type != "string" && !isIntType(field.Type) {
+			verr.addLine(line, "field %q oneof is only supported by string and integer types", field.Name)
+		} else if isIntType(field.Type) {
+			for _, v := range strings.Split(field.OneOf, ",") {
+				if _, err := parseRuleNumber(field.Type, strings.TrimSpace(v)); err != nil {
+					verr.addLine(line, "field %q oneof %s", field.Name, err.Error())
+				}
+			}
+		}
+	}
+}
+
+// 数值比较的表达式，decimal通过Cmp比较
+func ruleCompareExpr(field MetaField, op string, value string) string {
+	name := "meta." + ucfirst(field.Name)
+	if field.Type == "decimal" {
+		return fmt.Sprintf("%s.Cmp(%q) %s 0", name, value, op)
+	}
+	return fmt.Sprintf("%s %s %s", name, op, value)
+}
+
+func ruleLengthExpr(field MetaField) string {
+	if field.Type == "string" {
+		return "utf8.RuneCountInString(meta." + ucfirst(field.Name) + ")"
+	}
+	return "len(meta." + ucfirst(field.Name) + ")"
+}
+
+func genRuleCheck(field MetaField, cond string, rule string, message string) string {
+	return fmt.Sprintf(`
+	if %s {
+		errs = append(errs, &ValidationError{Field: "%s", Rule: "%s", Message: %q})
+	}`, cond, field.Name, rule, message)
+}
+
+// Validate方法按规则检查所有字段，enum字段同时检查取值范围，没有需要检查的字段时不生成
+func genValidateCode(meta Meta, funcName string) (code string) {
+	if !needValidate(meta) {
+		return
+	}
+	var checks string
+	for _, field := range meta.Fields.List {
+		name := "meta." + ucfirst(field.Name)
+		if field.Required {
+			switch {
+			case field.Type == "string" || field.Type == "decimal":
+				checks += genRuleCheck(field, name+` == ""`, "required", "is required")
+			case isDateType(field.Type) || field.Type == "objectid":
+				checks += genRuleCheck(field, name+".IsZero()", "required", "is required")
+			default:
+				checks += genRuleCheck(field, "len("+name+") == 0", "required", "is required")
+			}
+		}
+		if field.Min != "" {
+			checks += genRuleCheck(field, ruleCompareExpr(field, "<", field.Min), "min", "must be at least "+field.Min)
+		}
+		if field.Max != "" {
+			checks += genRuleCheck(field, ruleCompareExpr(field, ">", field.Max), "max", "must be at most "+field.Max)
+		}
+		if field.MinLen != 0 {
+			checks += genRuleCheck(field, fmt.Sprintf("%s < %d", ruleLengthExpr(field), field.MinLen), "minlen",
+				fmt.Sprintf("length must be at least %d", field.MinLen))
+		}
+		if field.MaxLen != 0 {
+			checks += genRuleCheck(field, fmt.Sprintf("%s > %d", ruleLengthExpr(field), field.MaxLen), "maxlen",
+				fmt.Sprintf("length must be at most %d", field.MaxLen))
+		}
+		// 非必填的空字符串不做格式检查
+		if field.Pattern != "" {
+			checks += genRuleCheck(field, fmt.Sprintf(`%s != "" && !pattern%s%s.MatchString(%s)`, name, funcName, ucfirst(field.Name), name),
+				"pattern", "does not match "+field.Pattern)
+			code += fmt.Sprintf("\nvar pattern%s%s = regexp.MustCompile(%s)\n", funcName, ucfirst(field.Name), strconv.Quote(field.Pattern))
+		}
+		if field.Format != "" {
+			checks += genRuleCheck(field, fmt.Sprintf(`%s != "" && !%s.MatchString(%s)`, name, ruleFormats[field.Format], name),
+				"format", "is not a valid "+field.Format)
+		}
+		if field.OneOf != "" {
+			var values []string
+			for _, v := range strings.Split(field.OneOf, ",") {
+				if field.Type == "string" {
+					values = append(values, strconv.Quote(strings.TrimSpace(v)))
+				} else {
+					values = append(values, strings.TrimSpace(v))
+				}
+			}
+			cond := fmt.Sprintf("!oneOf%s%s(%s)", funcName, ucfirst(field.Name), name)
+			if field.Type == "string" {
+				cond = name + ` != "" && ` + cond
+			}
+			checks += genRuleCheck(field, cond, "oneof", "must be one of "+field.OneOf)
+			code += fmt.Sprintf(`
+func oneOf%s%s(v %s) bool {
+	switch v {
+	case %s:
+		return true
+	}
+	return false
+}
+`, funcName, ucfirst(field.Name), getFieldGolangType(field), strings.Join(values, ", "))
+		}
+		if isEnumType(field.Type) {
+			checks += fmt.Sprintf(`
+	if !%s.Valid() {
+		errs = append(errs, &ValidationError{Field: "%s", Rule: "enum", Message: "invalid value " + %s.String()})
+	}`, name, field.Name, name)
+		}
+	}
+
+	code += fmt.Sprintf(`
+// ValidateFields 按meta中定义的规则校验字段，返回所有不合法的字段
+func (meta *Meta%s)ValidateFields() ValidationErrors {
+	var errs ValidationErrors%s
+	return errs
+}
+
+// Validate 校验失败时返回错误码为ValidationCode的play.ErrorCode，Save前会自动调用
+func (meta *Meta%s)Validate() error {
+	if errs := meta.ValidateFields(); len(errs) > 0 {
+		return errs.ErrorCode()
+	}
+	return nil
+}
+`, funcName, checks, funcName)
+	return
+}
+
+// 声明了validator的mongodb文档即使没有规则也生成Validate，与服务端的$jsonSchema校验对应
+func needValidate(meta Meta) bool {
+	if meta.Strategy.Storage.Validator {
+		return true
+	}
+	for _, field := range meta.Fields.List {
+		if hasRules(field) || isEnumType(field.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// 写入前调用Validate的代码片段，zero为错误时除err以外的返回值
+func genValidateCallCode(meta Meta, list bool, zero string) string {
+	if !needValidate(meta) {
+		return ""
+	}
+	if list {
+		return fmt.Sprintf(`for _, meta := range list {
+		if err := meta.Validate(); err != nil {
+			return %serr
+		}
+	}`, zero)
+	}
+	return fmt.Sprintf(`if err := meta.Validate(); err != nil {
+		return %serr
+	}`, zero)
+}
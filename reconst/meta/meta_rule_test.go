@@ -0,0 +1,108 @@
+package meta
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateRules(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML})
+	validate := funcSource(t, sources, "shop_user.go", "MetaShopUser.ValidateFields")
+	for _, want := range []string{
+		`&ValidationError{Field: "name", Rule: "required", Message: "is required"}`,
+		`if utf8.RuneCountInString(meta.Name) > 20 {`,
+		`if meta.Email != "" && !emailPattern.MatchString(meta.Email) {`,
+		`if meta.Age > 200 {`,
+	} {
+		if !strings.Contains(validate, want) {
+			t.Errorf("Validate does not contain %s:\n%s", want, validate)
+		}
+	}
+	save := funcSource(t, sources, "shop_user.go", "queryShopUser.save")
+	if !strings.Contains(save, "if err := meta.Validate(); err != nil {") {
+		t.Errorf("save should validate the meta:\n%s", save)
+	}
+	assertDecls(t, sources, "common.go", "ValidationError", "ValidationErrors", "ValidationErrors.ErrorCode", "emailPattern")
+}
+
+// 没有规则的meta不生成空的Validate，声明了validator的mongodb文档仍然生成
+func TestValidateOnlyWithRules(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML, "log.xml": testLogXML,
+		"topic.xml": testTopicXML, "reply.xml": testReplyXML})
+	assertNoDecls(t, sources, "shop_order.go", "MetaShopOrder.Validate")
+	assertNoDecls(t, sources, "forum_topic.go", "MetaForumTopic.Validate")
+	assertDecls(t, sources, "forum_reply.go", "MetaForumReply.Validate")
+	assertDecls(t, sources, "audit_log.go", "MetaAuditLog.Validate")
+	if save := funcSource(t, sources, "shop_order.go", "queryShopOrder.save"); strings.Contains(save, "Validate") {
+		t.Errorf("save should not validate a meta without rules:\n%s", save)
+	}
+	assertContains(t, sources, "common.go", "const ValidationCode = 0x101")
+}
+
+// Validate返回的错误是play.ErrorCode，Render按错误码输出，ValidateFields保留每个字段的错误
+func TestValidateRun(t *testing.T) {
+	buildProject(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML}, false, map[string]string{"rule_test.go": `package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/leochen2038/play"
+	"github.com/leochen2038/play/database/mysql"
+)
+
+func TestValidate(t *testing.T) {
+	meta := &MetaShopUser{Name: "bob", Email: "nope", Age: 300, Status: ShopUserStatusActive}
+	errs := meta.ValidateFields()
+	if len(errs) != 2 || errs[0].Field != "email" || errs[1].Rule != "max" {
+		t.Fatalf("ValidateFields() = %v", errs)
+	}
+	code, ok := meta.Validate().(*play.ErrorCode)
+	if !ok || code.Code() != ValidationCode || !strings.Contains(code.Info(), "age must be at most 200") {
+		t.Fatalf("Validate() = %#v", meta.Validate())
+	}
+
+	mysql.Calls = nil
+	if _, ok := ShopUser().Save(meta).(*play.ErrorCode); !ok || len(mysql.Calls) != 0 {
+		t.Errorf("Save should return the validation error without writing, calls %v", mysql.Calls)
+	}
+	meta.Email, meta.Age = "bob@example.com", 30
+	if err := meta.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
+`})
+}
+
+func TestCheckRules(t *testing.T) {
+	const itemXML = `<meta module="shop" name="item">
+  <key name="id" type="auto"/>
+  <fields>
+    <field name="level" type="uint8" max="255" oneof="1,2,255"/>
+    <field name="n" type="int64" min="-9223372036854775808"/>
+  </fields>
+  <strategy>
+    <storage type="mysql" database="shop" table="item"/>
+  </strategy>
+</meta>
+`
+	if _, err := decodeMeta("item.xml", []byte(itemXML)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		from string
+		to   string
+		err  string
+	}{
+		{`max="255"`, `max="256"`, `field "level" max`},
+		{`oneof="1,2,255"`, `oneof="1,2,256"`, `field "level" oneof`},
+		{`min="-9223372036854775808"`, `min="-9223372036854775809"`, `field "n" min`},
+		{`min="-9223372036854775808"`, `min="10" max="1"`, `field "n" min is greater than max`},
+		{`min="-9223372036854775808"`, `pattern="^a"`, `field "n" pattern and format are only supported by string`},
+		{`min="-9223372036854775808"`, `maxlen="3"`, `field "n" minlen and maxlen are only supported by string, bytes, array and map`},
+	}
+	for _, tt := range tests {
+		_, err := decodeMeta("item.xml", []byte(strings.Replace(itemXML, tt.from, tt.to, 1)))
+		assertError(t, err, tt.err)
+	}
+}
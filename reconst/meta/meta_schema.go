@@ -0,0 +1,184 @@
+package meta
+
+import (
+	"github.com/leochen2038/goplay/reconst/env"
+	"io/ioutil"
+	"os"
+)
+
+// meta xml的XSD定义，可在xml中通过xsi:noNamespaceSchemaLocation="meta.xsd"引用
+const metaXSD = `<?xml version="1.0" encoding="UTF-8"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" elementFormDefault="qualified">
+    <xs:element name="meta">
+        <xs:complexType>
+            <xs:sequence>
+                <xs:element name="key" type="keyType" maxOccurs="unbounded"/>
+                <xs:element name="fields" type="fieldsType" minOccurs="0"/>
+                <xs:element name="strategy" type="strategyType"/>
+                <xs:element name="relations" type="relationsType" minOccurs="0"/>
+            </xs:sequence>
+            <xs:attribute name="module" type="xs:string" use="required"/>
+            <xs:attribute name="name" type="xs:string" use="required"/>
+            <xs:attribute name="tag" type="xs:string"/>
+            <xs:attribute name="package">
+                <xs:simpleType>
+                    <xs:restriction base="xs:string">
+                        <xs:pattern value="[a-z][a-z0-9]*"/>
+                    </xs:restriction>
+                </xs:simpleType>
+            </xs:attribute>
+        </xs:complexType>
+    </xs:element>
+
+    <xs:complexType name="keyType">
+        <xs:attribute name="name" type="xs:string" use="required"/>
+        <xs:attribute name="type" type="xs:string" use="required"/>
+        <xs:attribute name="alias" type="xs:string"/>
+        <xs:attribute name="note" type="xs:string"/>
+        <xs:attribute name="default" type="xs:string"/>
+        <xs:attribute name="generate">
+            <xs:simpleType>
+                <xs:restriction base="xs:string">
+                    <xs:enumeration value="uuid4"/>
+                    <xs:enumeration value="uuid7"/>
+                    <xs:enumeration value="snowflake"/>
+                </xs:restriction>
+            </xs:simpleType>
+        </xs:attribute>
+    </xs:complexType>
+
+    <xs:complexType name="fieldsType">
+        <xs:sequence>
+            <xs:element name="field" type="fieldType" minOccurs="0" maxOccurs="unbounded"/>
+        </xs:sequence>
+    </xs:complexType>
+
+    <xs:complexType name="fieldType">
+        <xs:choice minOccurs="0" maxOccurs="unbounded">
+            <xs:element name="field" type="fieldType"/>
+            <xs:element name="value" type="enumValueType"/>
+        </xs:choice>
+        <xs:attribute name="name" type="xs:string" use="required"/>
+        <xs:attribute name="type" type="xs:string" use="required"/>
+        <xs:attribute name="alias" type="xs:string"/>
+        <xs:attribute name="note" type="xs:string"/>
+        <xs:attribute name="default" type="xs:string"/>
+        <xs:attribute name="unit">
+            <xs:simpleType>
+                <xs:restriction base="xs:string">
+                    <xs:enumeration value="second"/>
+                    <xs:enumeration value="millisecond"/>
+                    <xs:enumeration value="time"/>
+                </xs:restriction>
+            </xs:simpleType>
+        </xs:attribute>
+        <xs:attribute name="version" type="xs:boolean"/>
+        <xs:attribute name="required" type="xs:boolean"/>
+        <xs:attribute name="min" type="xs:string"/>
+        <xs:attribute name="max" type="xs:string"/>
+        <xs:attribute name="minlen" type="xs:nonNegativeInteger"/>
+        <xs:attribute name="maxlen" type="xs:nonNegativeInteger"/>
+        <xs:attribute name="pattern" type="xs:string"/>
+        <xs:attribute name="format">
+            <xs:simpleType>
+                <xs:restriction base="xs:string">
+                    <xs:enumeration value="email"/>
+                </xs:restriction>
+            </xs:simpleType>
+        </xs:attribute>
+        <xs:attribute name="oneof" type="xs:string"/>
+    </xs:complexType>
+
+    <xs:complexType name="enumValueType">
+        <xs:attribute name="name" type="xs:string" use="required"/>
+        <xs:attribute name="value" type="xs:string" use="required"/>
+        <xs:attribute name="note" type="xs:string"/>
+    </xs:complexType>
+
+    <xs:complexType name="strategyType">
+        <xs:all>
+            <xs:element name="storage" type="storageType"/>
+            <xs:element name="indexes" type="indexesType" minOccurs="0"/>
+            <xs:element name="cache" type="cacheType" minOccurs="0"/>
+        </xs:all>
+    </xs:complexType>
+
+    <xs:complexType name="cacheType">
+        <xs:attribute name="type" use="required">
+            <xs:simpleType>
+                <xs:restriction base="xs:string">
+                    <xs:enumeration value="lru"/>
+                    <xs:enumeration value="redis"/>
+                </xs:restriction>
+            </xs:simpleType>
+        </xs:attribute>
+        <xs:attribute name="ttl" type="xs:nonNegativeInteger"/>
+        <xs:attribute name="size" type="xs:positiveInteger"/>
+        <xs:attribute name="keys" type="xs:string"/>
+    </xs:complexType>
+
+    <xs:complexType name="storageType">
+        <xs:attribute name="type" use="required">
+            <xs:simpleType>
+                <xs:restriction base="xs:string">
+                    <xs:enumeration value="mysql"/>
+                    <xs:enumeration value="mongodb"/>
+                </xs:restriction>
+            </xs:simpleType>
+        </xs:attribute>
+        <xs:attribute name="database" type="xs:string" use="required"/>
+        <xs:attribute name="table" type="xs:string" use="required"/>
+        <xs:attribute name="drive" type="xs:string"/>
+        <xs:attribute name="router" type="xs:string"/>
+        <xs:attribute name="route" type="xs:string"/>
+        <xs:attribute name="validator" type="xs:boolean"/>
+        <xs:attribute name="tx" type="xs:boolean"/>
+    </xs:complexType>
+
+    <xs:complexType name="indexesType">
+        <xs:sequence>
+            <xs:element name="index" type="indexType" minOccurs="0" maxOccurs="unbounded"/>
+        </xs:sequence>
+    </xs:complexType>
+
+    <xs:complexType name="indexType">
+        <xs:attribute name="fields" type="xs:string" use="required"/>
+        <xs:attribute name="name" type="xs:string"/>
+        <xs:attribute name="unique" type="xs:boolean"/>
+        <xs:attribute name="ttl" type="xs:int"/>
+    </xs:complexType>
+
+    <xs:complexType name="relationsType">
+        <xs:sequence>
+            <xs:element name="relation" type="relationType" minOccurs="0" maxOccurs="unbounded"/>
+        </xs:sequence>
+    </xs:complexType>
+
+    <xs:complexType name="relationType">
+        <xs:attribute name="name" type="xs:string" use="required"/>
+        <xs:attribute name="type" use="required">
+            <xs:simpleType>
+                <xs:restriction base="xs:string">
+                    <xs:enumeration value="belongsTo"/>
+                    <xs:enumeration value="hasMany"/>
+                </xs:restriction>
+            </xs:simpleType>
+        </xs:attribute>
+        <xs:attribute name="module" type="xs:string" use="required"/>
+        <xs:attribute name="meta" type="xs:string" use="required"/>
+        <xs:attribute name="foreign" type="xs:string" use="required"/>
+    </xs:complexType>
+</xs:schema>
+`
+
+// WriteSchema 写入assets/meta/meta.xsd，由init和play meta schema调用，overwrite为false时保留已存在的文件
+func WriteSchema(overwrite bool) error {
+	path := env.ProjectPath + "/assets/meta"
+	if err := os.MkdirAll(path, 0744); err != nil {
+		return err
+	}
+	if _, err := os.Stat(path + "/meta.xsd"); err == nil && !overwrite {
+		return nil
+	}
+	return ioutil.WriteFile(path+"/meta.xsd", []byte(metaXSD), 0644)
+}
@@ -0,0 +1,44 @@
+package meta
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/leochen2038/goplay/reconst/env"
+)
+
+// 生成代码不写入meta.xsd，WriteSchema只在overwrite时覆盖已存在的文件
+func TestWriteSchema(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := generateIn(t, dir, map[string]string{"order.xml": testOrderXML, "user.xml": testUserXML}); err != nil {
+		t.Fatal(err)
+	}
+	path := dir + "/assets/meta/meta.xsd"
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("MetaGenerator should not write meta.xsd")
+	}
+
+	env.ProjectPath = dir
+	if err := WriteSchema(false); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != metaXSD {
+		t.Fatal("WriteSchema should create meta.xsd")
+	}
+	if err := ioutil.WriteFile(path, []byte("<edited/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteSchema(false); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "<edited/>" {
+		t.Error("WriteSchema(false) should keep an existing meta.xsd")
+	}
+	if err := WriteSchema(true); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != metaXSD {
+		t.Error("WriteSchema(true) should rewrite meta.xsd")
+	}
+}
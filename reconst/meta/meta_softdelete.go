@@ -0,0 +1,122 @@
+package meta
+
+import (
+	"fmt"
+)
+
+// meta中类型为dtime的字段作为软删除标记，没有则返回空
+func getSoftDeleteField(meta Meta) (MetaField, bool) {
+	field, err := getSpTTime(meta.Fields, "dtime")
+	return field, err == nil
+}
+
+// scope返回实际提交给驱动的查询副本，软删除的meta会在这里追加dtime条件
+func genScopeCode(meta Meta, funcName string) string {
+	return genSoftDeleteScopeCode(meta, funcName) + fmt.Sprintf(`
+// updateScope 复制scope和Sets，Update自动写入的字段不会留在q中，同一个查询可以重复执行
+func (q *query%s)updateScope() *play.Query {
+	query := *q.scope()
+	query.Sets = make(map[string][]interface{}, len(q.query.Sets)+2)
+	for field, args := range q.query.Sets {
+		query.Sets[field] = args
+	}
+	return &query
+}
+`, funcName)
+}
+
+func genSoftDeleteScopeCode(meta Meta, funcName string) string {
+	field, ok := getSoftDeleteField(meta)
+	if !ok {
+		return fmt.Sprintf(`
+func (q *query%s)scope() *play.Query {
+	query := q.query
+	return &query
+}
+`, funcName)
+	}
+
+	// 驱动支持Group和IsNull时未删除的记录同时包含dtime为NULL的旧数据，否则只按dtime为0过滤
+	group := hasCondition(meta, "Group")
+	exclude := fmt.Sprintf(`play.Condition{AndOr:true, Field:"%s", Con:"Equal", Val:%s}`, field.Name, timeZeroExpr(field))
+	if group && hasCondition(meta, "IsNull") {
+		exclude = fmt.Sprintf(`play.Condition{AndOr:true, Con:"Group", Val:[]play.Condition{
+		{AndOr:true, Field:"%s", Con:"Equal", Val:%s},
+		{AndOr:false, Field:"%s", Con:"IsNull"},
+	}}`, field.Name, timeZeroExpr(field), field.Name)
+	}
+
+	return fmt.Sprintf(`
+// WithTrashed 查询结果包含已软删除的记录
+func (q *query%s)WithTrashed() *query%s {
+	q.trashed = trashedWith
+	return q
+}
+
+// OnlyTrashed 只查询已软删除的记录
+func (q *query%s)OnlyTrashed() *query%s {
+	q.trashed = trashedOnly
+	return q
+}
+
+func (q *query%s)scope() *play.Query {
+	query := q.query
+	switch q.trashed {
+	case trashedOnly:
+		query.Conditions = andConditions(q.query.Conditions, %t, play.Condition{AndOr:true, Field:"%s", Con:"Greater", Val:%s})
+	case trashedExclude:
+		query.Conditions = andConditions(q.query.Conditions, %t, %s)
+	}
+	return &query
+}
+`, funcName, funcName, funcName, funcName, funcName, group, field.Name, timeZeroExpr(field), group, exclude)
+}
+
+func genDeleteCode(meta Meta, funcName string) string {
+	drive := meta.Strategy.Storage.Drive
+	field, ok := getSoftDeleteField(meta)
+	if !ok {
+		return fmt.Sprintf(`
+func (q *query%s)Delete() (int64, error) {
+	if q.check(false) != nil {
+		return 0, q.err
+	}
+	if err := beforeDelete(&Meta%s{}, q.scope()); err != nil {
+		return 0, err
+	}
+	%s
+	return %s.Delete(q.scope())
+}
+`, funcName, funcName, genCacheInvalidateCode(meta), drive)
+	}
+
+	return fmt.Sprintf(`
+// Delete 软删除，将%s设置为当前时间，与Update一样更新mtime和版本号，持有旧版本的记录不能再保存
+func (q *query%s)Delete() (int64, error) {
+	if q.check(false) != nil {
+		return 0, q.err
+	}
+	if err := beforeDelete(&Meta%s{}, q.scope()); err != nil {
+		return 0, err
+	}
+	%s
+	query := q.scope()
+	query.Sets = map[string][]interface{}{"%s": {%s}}
+	%s
+	%s
+}
+
+// ForceDelete 物理删除记录，已软删除的记录需要配合WithTrashed或OnlyTrashed
+func (q *query%s)ForceDelete() (int64, error) {
+	if q.check(false) != nil {
+		return 0, q.err
+	}
+	if err := beforeDelete(&Meta%s{}, q.scope()); err != nil {
+		return 0, err
+	}
+	%s
+	return %s.Delete(q.scope())
+}
+`, field.Name, funcName, funcName, genCacheInvalidateCode(meta), field.Name, timeValueExpr(field, "time.Now()"),
+		genUpdateTouchCode(meta), genUpdateExecCode(meta), funcName, funcName, genCacheInvalidateCode(meta), drive)
+}
@@ -0,0 +1,125 @@
+package meta
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSoftDelete(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML})
+	assertDecls(t, sources, "shop_user.go", "queryShopUser.WithTrashed", "queryShopUser.OnlyTrashed", "queryShopUser.ForceDelete")
+	assertNoDecls(t, sources, "shop_order.go", "queryShopOrder.WithTrashed", "queryShopOrder.ForceDelete")
+
+	scope := funcSource(t, sources, "shop_user.go", "queryShopUser.scope")
+	if !strings.Contains(scope, `"dtime"`) {
+		t.Errorf("scope should filter on dtime:\n%s", scope)
+	}
+}
+
+func TestSoftDeleteTouchesAndBumpsVersion(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML})
+	del := funcSource(t, sources, "shop_user.go", "queryShopUser.Delete")
+	for _, want := range []string{
+		`query.Sets = map[string][]interface{}{"dtime": {time.Now().Unix()}}`,
+		`query.Sets["mtime"] = []interface{}{time.Now().UnixNano() / int64(time.Millisecond)}`,
+		`query.Sets["version"] = []interface{}{1, "+"}`,
+		"return 0, ErrStaleObject",
+	} {
+		if !strings.Contains(del, want) {
+			t.Errorf("Delete does not contain %s:\n%s", want, del)
+		}
+	}
+}
+
+func TestSoftDeleteRejectsDefault(t *testing.T) {
+	src := strings.Replace(testUserXML, `<field name="dtime" type="dtime"/>`, `<field name="dtime" type="dtime" default="now"/>`, 1)
+	_, err := decodeMeta("user.xml", []byte(src))
+	assertError(t, err, `user.xml:16: soft delete field "dtime" can not have a default`)
+}
+
+func TestScopeCopiesQuery(t *testing.T) {
+	buildProject(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML}, false, map[string]string{"scope_test.go": `package db
+
+import "testing"
+
+func TestScope(t *testing.T) {
+	defer UseShopUserStore(NewShopUserMemoryStore(MetaShopUser{Id: 1, Name: "a"}))()
+	q := ShopUser().WhereIdEqual(1).SetName("b").WithTrashed()
+	if q.scope() == &q.query {
+		t.Fatal("scope should return a copy under WithTrashed")
+	}
+	if _, err := q.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := q.query.Sets["dtime"]; ok || len(q.query.Sets) != 1 {
+		t.Errorf("Delete should not overwrite the Sets of the query: %v", q.query.Sets)
+	}
+	if o := ShopOrder(); o.scope() == &o.query {
+		t.Error("scope should return a copy without soft delete")
+	}
+}
+`})
+}
+
+// 软删除的记录不出现在查询结果中，已发布的框架没有Group和IsNull时只按dtime为0过滤
+func TestSoftDeleteRun(t *testing.T) {
+	test := `package db
+
+import "testing"
+
+func TestSoftDelete(t *testing.T) {
+	if _, err := ShopUser().WhereNameEqual("a").OrAgeGreater(3).GetList(); err != nil {
+		t.Fatalf("driver: %v", err)
+	}
+
+	defer UseShopUserStore(NewShopUserMemoryStore(
+		MetaShopUser{Id: 1, Name: "a"},
+		MetaShopUser{Id: 2, Name: "b"},
+		MetaShopUser{Id: 3, Name: "c", Dtime: 100},
+	))()
+	if n, err := ShopUser().WhereIdEqual(2).Delete(); n != 1 || err != nil {
+		t.Fatalf("Delete() = %d, %v", n, err)
+	}
+	ids := func(q *queryShopUser) []int {
+		list, err := q.GetList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int
+		for _, v := range list {
+			ids = append(ids, v.Id)
+		}
+		return ids
+	}
+	if got := ids(ShopUser().WhereNameEqual("c").OrIdGreater(0).OrderBy("id", "asc")); len(got) != 1 || got[0] != 1 {
+		t.Errorf("deleted records should be hidden: %v", got)
+	}
+	if got := ids(ShopUser().OnlyTrashed().OrderBy("id", "asc")); len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Errorf("OnlyTrashed() = %v", got)
+	}
+	if got := ids(ShopUser().WithTrashed()); len(got) != 3 {
+		t.Errorf("WithTrashed() = %v", got)
+	}
+	if n, err := ShopUser().WhereIdEqual(3).Count(); n != 0 || err != nil {
+		t.Errorf("Count() of a deleted record = %d, %v", n, err)
+	}
+	if n, err := ShopUser().WhereIdEqual(3).ForceDelete(); n != 0 || err != nil {
+		t.Fatalf("ForceDelete() without WithTrashed = %d, %v, want 0", n, err)
+	}
+	if n, err := ShopUser().WhereIdEqual(3).WithTrashed().ForceDelete(); n != 1 || err != nil {
+		t.Fatalf("ForceDelete() of a deleted record = %d, %v", n, err)
+	}
+	if got := ids(ShopUser().WithTrashed().OrderBy("id", "asc")); len(got) != 2 || got[1] != 2 {
+		t.Errorf("WithTrashed() after ForceDelete = %v", got)
+	}
+}
+`
+	for _, released := range []bool{false, true} {
+		sources := buildProject(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML}, released,
+			map[string]string{"softdelete_test.go": test})
+		scope := funcSource(t, sources, "shop_user.go", "queryShopUser.scope")
+		if strings.Contains(scope, "IsNull") == released {
+			t.Errorf("released %v: scope should use IsNull only when the driver supports it:\n%s", released, scope)
+		}
+	}
+}
@@ -0,0 +1,527 @@
+package meta
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 查询通过<Name>Store接口执行，默认实现调用数据库驱动，测试时可以替换为生成的内存实现
+func storeVarName(funcName string) string {
+	return strings.ToLower(funcName[:1]) + funcName[1:] + "Store"
+}
+
+// 按字段常量设置meta中对应字段的值，供内存存储执行Update使用
+func genSetFieldValueCode(meta Meta, funcName string) (code string) {
+	code = fmt.Sprintf("\nfunc (meta *Meta%s)setFieldValue(field %sField, val interface{}) error {\n\tswitch field {\n", funcName, funcName)
+	for _, field := range meta.Fields.List {
+		code += fmt.Sprintf(`	case %sField%s:
+		v, ok := val.(%s)
+		if !ok {
+			return errors.New("%s.%s: invalid value for %s")
+		}
+		meta.%s = v
+`, funcName, formatUcfirstName(field.Name), getFieldGolangType(field), meta.Module, meta.Name, field.Name, ucfirst(field.Name))
+	}
+	code += "\t}\n\treturn nil\n}\n"
+	return
+}
+
+func genStoreCode(meta Meta, funcName string, drive string) string {
+	store := storeVarName(funcName)
+	mongo := meta.Strategy.Storage.Type == "mongodb"
+
+	type method struct {
+		name, params, args, results string
+	}
+	methods := []method{
+		{"GetOne", "meta *Meta" + funcName + ", query *play.Query", "meta, query", "error"},
+		{"GetList", "list *[]Meta" + funcName + ", query *play.Query", "list, query", "error"},
+		{"Count", "query *play.Query", "query", "(int64, error)"},
+		{"Update", "query *play.Query", "query", "(int64, error)"},
+		{"Delete", "query *play.Query", "query", "(int64, error)"},
+		{"UpdateMany", "list []*Meta" + funcName + ", query *play.Query", "list, query", "(int64, error)"},
+		{"Aggregate", "dest interface{}, fn string, field string, query *play.Query", "dest, fn, field, query", "error"},
+		{"GroupCount", "dest interface{}, field string, query *play.Query", "dest, field, query", "error"},
+	}
+	if mongo {
+		methods = append(methods,
+			method{"Save", "meta *Meta" + funcName + ", id *primitive.ObjectID, query *play.Query", "meta, id, query", "error"},
+			method{"SaveMany", "list []*Meta" + funcName + ", query *play.Query", "list, query", "error"},
+			method{"Upsert", "meta *Meta" + funcName + ", filter bson.M, insertOnly []string, query *play.Query", "meta, filter, insertOnly, query", "error"},
+			method{"UpdateAndGetOne", "meta *Meta" + funcName + ", query *play.Query", "meta, query", "error"})
+	} else {
+		methods = append(methods,
+			method{"Save", "meta *Meta" + funcName + ", query *play.Query", "meta, query", "(int64, error)"},
+			method{"SaveMany", "list []*Meta" + funcName + ", query *play.Query", "list, query", "([]int64, error)"},
+			method{"Upsert", "meta *Meta" + funcName + ", conflict []string, insertOnly []string, query *play.Query", "meta, conflict, insertOnly, query", "(int64, error)"})
+	}
+
+	var iface, driver string
+	for _, m := range methods {
+		if !hasStoreMethod(meta, m.name) {
+			continue
+		}
+		iface += fmt.Sprintf("\t%s(%s) %s\n", m.name, m.params, m.results)
+		driver += fmt.Sprintf("\nfunc (%sDriver) %s(%s) %s {\n\treturn %s.%s(%s)\n}\n", store, m.name, m.params, m.results, drive, m.name, m.args)
+	}
+
+	code := fmt.Sprintf(`
+// %sStore 执行%s查询的存储，默认由%s驱动实现，测试时可以通过Use%sStore替换为New%sMemoryStore()
+type %sStore interface {
+%s}
+
+type %sDriver struct{}
+%s
+var %s %sStore = %sDriver{}
+
+// Use%sStore 替换%s查询使用的存储，返回的函数用于恢复之前的存储
+func Use%sStore(store %sStore) (restore func()) {
+	prev := %s
+	%s = store%s
+	return func() {
+		%s = prev%s
+	}
+}
+`, funcName, funcName, drive, funcName, funcName,
+		funcName, iface,
+		store, driver,
+		store, funcName, store,
+		funcName, funcName, funcName, funcName, store, store, genCacheResetCode(meta, funcName), store, genCacheResetCode(meta, funcName))
+
+	return code + genSetFieldValueCode(meta, funcName) + genMemoryStoreCode(meta, funcName)
+}
+
+// SaveMany、Upsert、UpdateMany、Aggregate、GroupCount直接调用v0.4.5之后加入的驱动函数，
+// 框架没有提供或者meta没有用到时接口和实现中都没有这些方法
+func hasStoreMethod(meta Meta, name string) bool {
+	switch name {
+	case "SaveMany", "Upsert", "UpdateMany":
+		return hasDriveAPI(meta, name)
+	case "Aggregate":
+		return hasAggregate(meta)
+	case "GroupCount":
+		return hasGroupCount(meta)
+	}
+	return true
+}
+
+// 内存存储按与数据库相同的条件、排序和分页语义执行查询，忽略路由和事务
+func genMemoryStoreCode(meta Meta, funcName string) string {
+	mongo := meta.Strategy.Storage.Type == "mongodb"
+	key := formatUcfirstName(meta.Key.Name)
+	notFound, duplicate := "sql.ErrNoRows", "ErrDuplicateKey"
+	if mongo {
+		notFound = "mongo.ErrNoDocuments"
+		duplicate = `mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "E11000 duplicate key error"}}}`
+	}
+
+	var sameKey []string
+	for _, k := range meta.Keys {
+		sameKey = append(sameKey, fmt.Sprintf("s.list[i].%s == meta.%s", formatUcfirstName(k.Name), formatUcfirstName(k.Name)))
+	}
+
+	// 自增主键在写入时分配，其他主键由调用方或generate策略给出
+	var nextKey string
+	if isAutoIncrementKey(meta) {
+		nextKey = fmt.Sprintf(`if meta.%s == 0 {
+		s.lastID++
+		meta.%s = %s(s.lastID)
+	} else if int64(meta.%s) > s.lastID {
+		s.lastID = int64(meta.%s)
+	}
+	`, key, key, getKeyGolangType(meta), key, key)
+	}
+	insertResult := "0"
+	if isAutoIncrementKey(meta) {
+		insertResult = "int64(meta." + key + ")"
+	}
+
+	code := fmt.Sprintf(`
+// %sMemoryStore 保存在内存中的%sStore实现，用于单元测试
+type %sMemoryStore struct {
+	mu     sync.Mutex
+	list   []Meta%s
+	lastID int64
+}
+
+// New%sMemoryStore 创建内存存储，list为初始数据
+func New%sMemoryStore(list ...Meta%s) *%sMemoryStore {
+	s := &%sMemoryStore{}
+	for i := range list {
+		s.put(&list[i])
+	}
+	return s
+}
+
+// Records 返回存储中的全部记录
+func (s *%sMemoryStore) Records() []Meta%s {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Meta%s{}, s.list...)
+}
+
+func (s *%sMemoryStore) index(meta *Meta%s) int {
+	for i := range s.list {
+		if %s {
+			return i
+		}
+	}
+	return -1
+}
+
+// put 写入记录，主键已存在时替换原记录
+func (s *%sMemoryStore) put(meta *Meta%s) int64 {
+	%sif i := s.index(meta); i >= 0 {
+		s.list[i] = *meta
+	} else {
+		s.list = append(s.list, *meta)
+	}
+	return %s
+}
+
+// insert 与数据库一样，主键已存在时返回主键冲突的错误
+func (s *%sMemoryStore) insert(meta *Meta%s) (int64, error) {
+	%sif s.index(meta) >= 0 {
+		return 0, %s
+	}
+	s.list = append(s.list, *meta)
+	return %s, nil
+}
+
+// insertMany 全部写入或者全部不写入
+func (s *%sMemoryStore) insertMany(list []*Meta%s) ([]int64, error) {
+	size, lastID := len(s.list), s.lastID
+	ids := make([]int64, 0, len(list))
+	for _, meta := range list {
+		id, err := s.insert(meta)
+		if err != nil {
+			s.list, s.lastID = s.list[:size], lastID
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// project 只保留query.Fields中的字段，与驱动只读取查询的字段一致
+func (s *%sMemoryStore) project(i int, fields map[string]bool) Meta%s {
+	if len(fields) == 0 {
+		return s.list[i]
+	}
+	var meta Meta%s
+%s	return meta
+}
+
+// find 返回满足条件的记录下标，ordered为true时按query.Order排序并按query.Limit截取
+func (s *%sMemoryStore) find(query *play.Query, ordered bool) ([]int, error) {
+	var indexes []int
+	for i := range s.list {
+		ok, err := memoryMatch(query.Conditions, func(field string) interface{} {
+			return s.list[i].fieldValue(%sField(field))
+		})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			indexes = append(indexes, i)
+		}
+	}
+	if !ordered {
+		return indexes, nil
+	}
+	memorySort(indexes, query.Order, func(i int, field string) interface{} {
+		return s.list[i].fieldValue(%sField(field))
+	})
+	start, end := memoryLimit(len(indexes), query.Limit)
+	return indexes[start:end], nil
+}
+
+func (s *%sMemoryStore) GetOne(meta *Meta%s, query *play.Query) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	indexes, err := s.find(query, true)
+	if err != nil {
+		return err
+	}
+	if len(indexes) == 0 {
+		return %s
+	}
+	*meta = s.project(indexes[0], query.Fields)
+	return nil
+}
+
+func (s *%sMemoryStore) GetList(list *[]Meta%s, query *play.Query) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	indexes, err := s.find(query, true)
+	if err != nil {
+		return err
+	}
+	*list = (*list)[:0]
+	for _, i := range indexes {
+		*list = append(*list, s.project(i, query.Fields))
+	}
+	return nil
+}
+
+func (s *%sMemoryStore) Count(query *play.Query) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	indexes, err := s.find(query, false)
+	return int64(len(indexes)), err
+}
+
+func (s *%sMemoryStore) update(query *play.Query) ([]int, error) {
+	indexes, err := s.find(query, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range indexes {
+		for field, args := range query.Sets {
+			val, err := memorySetValue(s.list[i].fieldValue(%sField(field)), args)
+			if err != nil {
+				return nil, err
+			}
+			if err = s.list[i].setFieldValue(%sField(field), val); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return indexes, nil
+}
+
+func (s *%sMemoryStore) Update(query *play.Query) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	indexes, err := s.update(query)
+	return int64(len(indexes)), err
+}
+
+func (s *%sMemoryStore) Delete(query *play.Query) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	indexes, err := s.find(query, true)
+	if err != nil {
+		return 0, err
+	}
+	deleted := make(map[int]bool, len(indexes))
+	for _, i := range indexes {
+		deleted[i] = true
+	}
+	list := s.list[:0]
+	for i, meta := range s.list {
+		if !deleted[i] {
+			list = append(list, meta)
+		}
+	}
+	s.list = list
+	return int64(len(indexes)), nil
+}
+`, funcName, funcName, funcName, funcName,
+		funcName, funcName, funcName, funcName, funcName,
+		funcName, funcName, funcName,
+		funcName, funcName, strings.Join(sameKey, " && "),
+		funcName, funcName, nextKey, insertResult,
+		funcName, funcName, nextKey, duplicate, insertResult,
+		funcName, funcName,
+		funcName, funcName, funcName, genProjectCode(meta),
+		funcName, funcName, funcName,
+		funcName, funcName, notFound,
+		funcName, funcName,
+		funcName,
+		funcName, funcName, funcName,
+		funcName,
+		funcName)
+
+	methods := map[string]string{"UpdateMany": fmt.Sprintf(`
+func (s *%sMemoryStore) UpdateMany(list []*Meta%s, query *play.Query) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, meta := range list {
+		if i := s.index(meta); i >= 0 {
+			s.list[i] = *meta
+			n++
+		}
+	}
+	return n, nil
+}
+`, funcName, funcName),
+		"values": fmt.Sprintf(`
+func (s *%sMemoryStore) values(query *play.Query, field string) ([]interface{}, error) {
+	indexes, err := s.find(query, false)
+	values := make([]interface{}, 0, len(indexes))
+	for _, i := range indexes {
+		values = append(values, s.list[i].fieldValue(%sField(field)))
+	}
+	return values, err
+}
+`, funcName, funcName),
+		"Aggregate": fmt.Sprintf(`
+func (s *%sMemoryStore) Aggregate(dest interface{}, fn string, field string, query *play.Query) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values, err := s.values(query, field)
+	if err != nil {
+		return err
+	}
+	return memoryAggregate(dest, fn, values)
+}
+`, funcName),
+		"GroupCount": fmt.Sprintf(`
+func (s *%sMemoryStore) GroupCount(dest interface{}, field string, query *play.Query) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values, err := s.values(query, field)
+	if err != nil {
+		return err
+	}
+	return memoryGroupCount(dest, values)
+}
+`, funcName)}
+
+	if mongo {
+		code += fmt.Sprintf(`
+// Save id为nil时插入记录，否则替换主键为id的记录
+func (s *%sMemoryStore) Save(meta *Meta%s, id *primitive.ObjectID, query *play.Query) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id == nil {
+		_, err := s.insert(meta)
+		return err
+	}
+	s.put(meta)
+	return nil
+}
+
+func (s *%sMemoryStore) UpdateAndGetOne(meta *Meta%s, query *play.Query) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	one := *query
+	one.Limit = [2]int64{query.Limit[0], 1}
+	indexes, err := s.update(&one)
+	if err != nil {
+		return err
+	}
+	if len(indexes) == 0 {
+		return %s
+	}
+	*meta = s.project(indexes[0], query.Fields)
+	return nil
+}
+`, funcName, funcName, funcName, funcName, notFound)
+		methods["SaveMany"] = fmt.Sprintf(`
+func (s *%sMemoryStore) SaveMany(list []*Meta%s, query *play.Query) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.insertMany(list)
+	return err
+}
+`, funcName, funcName)
+		methods["Upsert"] = fmt.Sprintf(`
+// Upsert 以filter中的字段识别记录，存在时保留原记录的主键和insertOnly字段
+func (s *%sMemoryStore) Upsert(meta *Meta%s, filter bson.M, insertOnly []string, query *play.Query) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.list {
+		matched := true
+		for field, val := range filter {
+			matched = matched && memoryCompare(s.list[i].fieldValue(%sField(field)), val) == 0
+		}
+		if matched {
+			%s
+			for _, field := range insertOnly {
+				if err := meta.setFieldValue(%sField(field), s.list[i].fieldValue(%sField(field))); err != nil {
+					return err
+				}
+			}
+			s.list[i] = *meta
+			return nil
+		}
+	}
+	_, err := s.insert(meta)
+	return err
+}
+`, funcName, funcName, funcName, upsertKeepCode(meta), funcName, funcName)
+	} else {
+		code += fmt.Sprintf(`
+func (s *%sMemoryStore) Save(meta *Meta%s, query *play.Query) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insert(meta)
+}
+`, funcName, funcName)
+		methods["SaveMany"] = fmt.Sprintf(`
+func (s *%sMemoryStore) SaveMany(list []*Meta%s, query *play.Query) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insertMany(list)
+}
+`, funcName, funcName)
+		methods["Upsert"] = fmt.Sprintf(`
+// Upsert 以conflict中的字段识别记录，与ON DUPLICATE KEY一样没有conflict时按主键识别，存在时保留原记录的主键和insertOnly字段
+func (s *%sMemoryStore) Upsert(meta *Meta%s, conflict []string, insertOnly []string, query *play.Query) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(conflict) == 0 {
+		conflict = []string{%s}
+	}
+	for i := range s.list {
+		matched := true
+		for _, field := range conflict {
+			matched = matched && memoryCompare(s.list[i].fieldValue(%sField(field)), meta.fieldValue(%sField(field))) == 0
+		}
+		if matched {
+			%s
+			for _, field := range insertOnly {
+				if err := meta.setFieldValue(%sField(field), s.list[i].fieldValue(%sField(field))); err != nil {
+					return 0, err
+				}
+			}
+			s.list[i] = *meta
+			return %s, nil
+		}
+	}
+	return s.insert(meta)
+}
+`, funcName, funcName, keyNamesCode(meta), funcName, funcName, upsertKeepCode(meta), funcName, funcName, insertResult)
+	}
+
+	if hasStoreMethod(meta, "Aggregate") || hasStoreMethod(meta, "GroupCount") {
+		code += methods["values"]
+	}
+	for _, name := range []string{"UpdateMany", "Aggregate", "GroupCount", "SaveMany", "Upsert"} {
+		if hasStoreMethod(meta, name) {
+			code += methods[name]
+		}
+	}
+	return code
+}
+
+func keyNamesCode(meta Meta) string {
+	names := make([]string, 0, len(meta.Keys))
+	for _, k := range meta.Keys {
+		names = append(names, strconv.Quote(k.Name))
+	}
+	return strings.Join(names, ", ")
+}
+
+// 更新已存在的记录时保留原记录的主键，ctime等insertOnly字段由Upsert按参数保留
+func upsertKeepCode(meta Meta) (code string) {
+	for _, k := range meta.Keys {
+		code += fmt.Sprintf("meta.%s = s.list[i].%s\n\t\t\t", formatUcfirstName(k.Name), formatUcfirstName(k.Name))
+	}
+	return strings.TrimSpace(code)
+}
+
+// 按query.Fields复制字段，字段名与Select、Omit使用的一致
+func genProjectCode(meta Meta) (code string) {
+	for _, key := range meta.Keys {
+		code += fmt.Sprintf("\tif fields[\"%s\"] {\n\t\tmeta.%s = s.list[i].%s\n\t}\n", key.Name, formatUcfirstName(key.Name), formatUcfirstName(key.Name))
+	}
+	for _, field := range meta.Fields.List {
+		code += fmt.Sprintf("\tif fields[\"%s\"] {\n\t\tmeta.%s = s.list[i].%s\n\t}\n", field.Name, ucfirst(field.Name), ucfirst(field.Name))
+	}
+	return
+}
@@ -0,0 +1,115 @@
+package meta
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML, "log.xml": testLogXML})
+	methods := []string{"GetOne", "GetList", "Count", "Update", "Delete", "UpdateMany", "Aggregate", "GroupCount", "Save", "SaveMany", "Upsert"}
+	for filename, name := range map[string]string{"shop_user.go": "ShopUser", "audit_log.go": "AuditLog"} {
+		assertDecls(t, sources, filename, name+"Store", "Use"+name+"Store", "New"+name+"MemoryStore", name+"MemoryStore.Records")
+		for _, method := range methods {
+			assertDecls(t, sources, filename, name+"MemoryStore."+method)
+		}
+	}
+	assertContains(t, sources, "common.go", "func memoryMatch(conditions []play.Condition, value func(field string) interface{}) (bool, error) {")
+}
+
+func TestMemoryStoreDuplicateKey(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML, "log.xml": testLogXML})
+	insert := funcSource(t, sources, "shop_user.go", "ShopUserMemoryStore.insert")
+	if !strings.Contains(insert, "return 0, ErrDuplicateKey") {
+		t.Errorf("mysql insert should return ErrDuplicateKey:\n%s", insert)
+	}
+	insert = funcSource(t, sources, "audit_log.go", "AuditLogMemoryStore.insert")
+	if !strings.Contains(insert, "mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000") {
+		t.Errorf("mongodb insert should return a duplicate key write exception:\n%s", insert)
+	}
+	insertMany := funcSource(t, sources, "shop_user.go", "ShopUserMemoryStore.insertMany")
+	if !strings.Contains(insertMany, "s.list, s.lastID = s.list[:size], lastID") {
+		t.Errorf("insertMany should roll back on error:\n%s", insertMany)
+	}
+	for _, method := range []string{"Save", "SaveMany"} {
+		if src := funcSource(t, sources, "shop_user.go", "ShopUserMemoryStore."+method); !strings.Contains(src, "s.insert") {
+			t.Errorf("mysql %s should insert:\n%s", method, src)
+		}
+	}
+}
+
+func TestMemoryStoreUpsertAndProjection(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML})
+	upsert := funcSource(t, sources, "shop_user.go", "ShopUserMemoryStore.Upsert")
+	if !strings.Contains(upsert, "for _, field := range insertOnly {") {
+		t.Errorf("Upsert should keep insertOnly fields of the existing record:\n%s", upsert)
+	}
+	for _, method := range []string{"GetOne", "GetList"} {
+		if src := funcSource(t, sources, "shop_user.go", "ShopUserMemoryStore."+method); !strings.Contains(src, "s.project(") {
+			t.Errorf("%s should apply the field projection:\n%s", method, src)
+		}
+	}
+	assertDecls(t, sources, "shop_user.go", "ShopUserMemoryStore.project")
+}
+
+// 内存存储中只有可以为nil的值是NULL，无符号数的加减不经过int64
+func TestMemoryNullAndUnsignedRun(t *testing.T) {
+	const counterXML = `<meta module="shop" name="counter">
+  <key name="id" type="auto"/>
+  <fields>
+    <field name="hits" type="uint64"/>
+    <field name="note" type="string"/>
+    <field name="tags" type="array:string"/>
+  </fields>
+  <strategy>
+    <storage type="mysql" database="shop" table="counter"/>
+  </strategy>
+</meta>
+`
+	buildProject(t, map[string]string{"counter.xml": counterXML}, false, map[string]string{"memory_test.go": `package db
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMemoryNull(t *testing.T) {
+	defer UseShopCounterStore(NewShopCounterMemoryStore(
+		MetaShopCounter{Id: 1, Hits: math.MaxInt64 + 5},
+		MetaShopCounter{Id: 2, Note: "a", Tags: []string{"x"}},
+	))()
+	for name, q := range map[string]*queryShopCounter{
+		"note IsNull":    ShopCounter().WhereNoteIsNull(),
+		"hits IsNull":    ShopCounter().WhereHitsIsNull(),
+		"tags IsNotNull": ShopCounter().WhereTagsIsNotNull(),
+	} {
+		want := int64(0)
+		if name == "tags IsNotNull" {
+			want = 1
+		}
+		if n, err := q.Count(); err != nil || n != want {
+			t.Errorf("%s count = %d, %v, want %d", name, n, err, want)
+		}
+	}
+	if n, err := ShopCounter().WhereTagsIsNull().Count(); err != nil || n != 1 {
+		t.Errorf("tags IsNull count = %d, %v, want 1", n, err)
+	}
+}
+
+func TestMemoryUnsigned(t *testing.T) {
+	defer UseShopCounterStore(NewShopCounterMemoryStore(MetaShopCounter{Id: 1, Hits: math.MaxInt64 + 5}))()
+	if _, err := ShopCounter().WhereIdEqual(1).SetHits(10, "+").Update(); err != nil {
+		t.Fatal(err)
+	}
+	if meta, err := ShopCounter().WhereIdEqual(1).GetOne(); err != nil || meta.Hits != math.MaxInt64+15 {
+		t.Fatalf("hits = %v, %v, want %d", meta, err, uint64(math.MaxInt64+15))
+	}
+	if _, err := ShopCounter().WhereIdEqual(1).SetHits(math.MaxUint64, "+").Update(); err == nil {
+		t.Error("adding past MaxUint64 should fail")
+	}
+	if _, err := ShopCounter().WhereIdEqual(1).SetHits(math.MaxUint64, "-").Update(); err == nil {
+		t.Error("subtracting below 0 should fail")
+	}
+}
+`})
+}
@@ -0,0 +1,92 @@
+package meta
+
+import (
+	"strings"
+)
+
+// ctime/mtime/dtime字段可以通过unit属性选择存储方式：second(默认)、millisecond、time
+var timeUnits = []string{"", "second", "millisecond", "time"}
+
+func isTimeType(t string) bool {
+	return t == "ctime" || t == "mtime" || t == "dtime"
+}
+
+func getFieldGolangType(field MetaField) string {
+	if field.goType != "" {
+		return field.goType
+	}
+	if isTimeType(field.Type) && field.Unit == "time" {
+		return "time.Time"
+	}
+	return getGolangType(field.Type)
+}
+
+// 以now(time.Time)计算时间字段的取值表达式
+func timeValueExpr(field MetaField, now string) string {
+	switch field.Unit {
+	case "millisecond":
+		return now + ".UnixNano() / int64(time.Millisecond)"
+	case "time":
+		return now
+	}
+	return now + ".Unix()"
+}
+
+func timeZeroExpr(field MetaField) string {
+	if field.Unit == "time" {
+		return "time.Time{}"
+	}
+	return "int64(0)"
+}
+
+// 判断时间字段为零值的条件，time.Time{}在if条件中无法解析，使用IsZero
+func timeIsZeroCond(field MetaField, expr string) string {
+	if field.Unit == "time" {
+		return expr + ".IsZero()"
+	}
+	return expr + " == 0"
+}
+
+func getKeyZeroValue(meta Meta) string {
+	if meta.Strategy.Storage.Type == "mongodb" {
+		return "primitive.NilObjectID"
+	}
+	if getKeyGolangType(meta) == "string" {
+		return `""`
+	}
+	return "0"
+}
+
+// 写入前填充时间字段：mtime每次写入都更新，ctime为零值时写入，
+// 更新已存在的记录时ctime不在写入的字段中，因此只有新记录会保存这里写入的ctime
+func genTouchCode(meta Meta, target string) string {
+	var lines []string
+	if field, err := getSpTTime(meta.Fields, "mtime"); err == nil {
+		lines = append(lines, target+"."+ucfirst(field.Name)+" = "+timeValueExpr(field, "now"))
+	}
+	if field, err := getSpTTime(meta.Fields, "ctime"); err == nil {
+		lines = append(lines, "if "+timeIsZeroCond(field, target+"."+ucfirst(field.Name))+" {\n\t\t"+target+"."+ucfirst(field.Name)+" = "+timeValueExpr(field, "now")+"\n\t}")
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "now := time.Now()\n\t" + strings.Join(lines, "\n\t")
+}
+
+// upsert时只在插入新记录时写入的字段，记录已存在时保留原值
+func genInsertOnlyCode(meta Meta) string {
+	if field, err := getSpTTime(meta.Fields, "ctime"); err == nil {
+		return `[]string{"` + field.Name + `"}`
+	}
+	return "nil"
+}
+
+// 更新时没有显式设置mtime则自动写入当前时间
+func genUpdateTouchCode(meta Meta) string {
+	field, err := getSpTTime(meta.Fields, "mtime")
+	if err != nil {
+		return ""
+	}
+	return "if _, ok := query.Sets[\"" + field.Name + "\"]; !ok {\n\t\tquery.Sets[\"" + field.Name + "\"] = []interface{}{" +
+		timeValueExpr(field, "time.Now()") + "}\n\t}"
+}
@@ -0,0 +1,71 @@
+package meta
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTimeFieldsTouched(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML})
+	save := funcSource(t, sources, "shop_user.go", "queryShopUser.save")
+	for _, want := range []string{
+		"meta.Mtime = now.UnixNano() / int64(time.Millisecond)",
+		"if meta.Ctime == 0 {\n\t\tmeta.Ctime = now.Unix()",
+	} {
+		if !strings.Contains(save, want) {
+			t.Errorf("save does not contain %s:\n%s", want, save)
+		}
+	}
+	update := funcSource(t, sources, "shop_user.go", "queryShopUser.Update")
+	if !strings.Contains(update, `if _, ok := query.Sets["mtime"]; !ok {`) {
+		t.Errorf("Update should touch mtime:\n%s", update)
+	}
+	if strings.Contains(update, `query.Sets["ctime"]`) {
+		t.Errorf("Update should not touch ctime:\n%s", update)
+	}
+}
+
+func TestTimeUnitOnlyOnTimeFields(t *testing.T) {
+	src := strings.Replace(testUserXML, `<field name="age" type="int"`, `<field name="age" type="int" unit="second"`, 1)
+	_, err := decodeMeta("user.xml", []byte(src))
+	assertError(t, err, `field "age" unit is only supported by ctime, mtime and dtime`)
+}
+
+// Save写入ctime和mtime，Update只刷新mtime，mtime按unit保存为毫秒
+func TestTimeFieldsRun(t *testing.T) {
+	buildProject(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML}, false, map[string]string{"time_test.go": `package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTouch(t *testing.T) {
+	defer UseShopUserStore(NewShopUserMemoryStore())()
+	before := time.Now()
+	user := &MetaShopUser{Name: "bob", Status: ShopUserStatusActive}
+	if err := ShopUser().Save(user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Ctime < before.Unix() || user.Ctime > time.Now().Unix() {
+		t.Errorf("ctime = %d, want seconds near %d", user.Ctime, before.Unix())
+	}
+	if ms := before.UnixNano() / int64(time.Millisecond); user.Mtime < ms || user.Mtime > ms+1000 {
+		t.Errorf("mtime = %d, want milliseconds near %d", user.Mtime, ms)
+	}
+
+	ctime, mtime := user.Ctime, user.Mtime
+	time.Sleep(5 * time.Millisecond)
+	if _, err := ShopUser().WhereIdEqual(user.Id).SetAge(3).Update(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ShopUser().WhereIdEqual(user.Id).GetOne()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Ctime != ctime || got.Mtime <= mtime {
+		t.Errorf("after Update ctime = %d (was %d), mtime = %d (was %d)", got.Ctime, ctime, got.Mtime, mtime)
+	}
+}
+`})
+}
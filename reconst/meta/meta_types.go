@@ -0,0 +1,40 @@
+package meta
+
+// datetime、date与ctime等时间字段一样映射为time.Time，mysql的dsn需要开启parseTime
+func isDateType(t string) bool {
+	return t == "datetime" || t == "date"
+}
+
+// mongodb中json字段直接保存为文档，不需要JSON类型
+func prepareJSONFields(fields []MetaField) []MetaField {
+	list := make([]MetaField, 0, len(fields))
+	for _, field := range fields {
+		switch field.Type {
+		case "json":
+			field.goType = "interface{}"
+		case "array:json":
+			field.goType = "[]interface{}"
+		case "map:json":
+			field.goType = "map[string]interface{}"
+		}
+		field.Fields = prepareJSONFields(field.Fields)
+		list = append(list, field)
+	}
+	return list
+}
+
+// objectid与mongodb的_id主键类型一致，用于关联mongodb的meta
+func isObjectIDType(t string) bool {
+	return t == "objectid" || t == "array:objectid" || t == "map:objectid"
+}
+
+// 字段类型必须能映射为go类型，避免生成无法编译的代码
+func isKnownType(field MetaField) bool {
+	field = parseLegacyObject(field)
+	return isEnumType(field.Type) || isObjectType(field) || getGolangType(field.Type) != ""
+}
+
+func knownTypeNames() string {
+	return "int, int64, uint, uint8, uint16, uint32, uint64, float, string, bool, decimal, datetime, date, bytes, json, objectid, " +
+		"ctime, mtime, dtime, enum, enum:string, object, array[:type], map[:type]"
+}
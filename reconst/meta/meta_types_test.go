@@ -0,0 +1,38 @@
+package meta
+
+import "testing"
+
+const testTypesXML = `<meta module="shop" name="stock">
+  <key name="sku" type="string"/>
+  <fields>
+    <field name="qty" type="uint32"/>
+    <field name="price" type="decimal"/>
+    <field name="born" type="datetime"/>
+    <field name="day" type="date"/>
+    <field name="raw" type="bytes"/>
+    <field name="doc" type="json"/>
+    <field name="mtime" type="mtime" unit="time"/>
+  </fields>
+  <strategy>
+    <storage type="mysql" database="shop" table="stock"/>
+  </strategy>
+</meta>
+`
+
+func TestFieldTypes(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"stock.xml": testTypesXML})
+	assertContains(t, sources, "shop_stock.go",
+		"Qty   uint32    `db:\"qty\"`",
+		"Price Decimal   `db:\"price\"`",
+		"Born  time.Time `db:\"born\"`",
+		"Day   time.Time `db:\"day\"`",
+		"Raw   []byte    `db:\"raw\"`",
+		"Doc   JSON      `db:\"doc\"`",
+		"Mtime time.Time `db:\"mtime\"`",
+	)
+	assertDecls(t, sources, "common.go", "Decimal", "NewDecimal", "Decimal.Add", "Decimal.Scale", "Decimal.Value", "Decimal.Scan", "JSON", "JSON.Scan")
+	assertNoDecls(t, sources, "common.go", "Decimal.MarshalBSONValue")
+
+	sources = mustGenerate(t, map[string]string{"log.xml": testLogXML})
+	assertDecls(t, sources, "common.go", "Decimal.MarshalBSONValue", "Decimal.UnmarshalBSONValue")
+}
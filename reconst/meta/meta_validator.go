@@ -0,0 +1,354 @@
+package meta
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"go/token"
+	"io"
+	"strings"
+	"unicode"
+)
+
+type elementRule struct {
+	attrs    []string
+	required []string
+	children []string
+	must     []string
+}
+
+// meta xml中允许出现的元素与属性，需要与metaXSD保持一致
+var elementRules = map[string]elementRule{
+	"meta": {
+		attrs:    []string{"module", "name", "tag", "package"},
+		required: []string{"module", "name"},
+		children: []string{"key", "fields", "strategy", "relations"},
+		must:     []string{"key", "strategy"},
+	},
+	"key": {
+		attrs:    []string{"name", "alias", "type", "note", "default", "generate"},
+		required: []string{"name", "type"},
+	},
+	"fields": {
+		children: []string{"field"},
+	},
+	"field": {
+		attrs:    []string{"name", "alias", "type", "note", "default", "unit", "version", "required", "min", "max", "minlen", "maxlen", "pattern", "format", "oneof"},
+		required: []string{"name", "type"},
+		children: []string{"field", "value"},
+	},
+	"value": {
+		attrs:    []string{"name", "value", "note"},
+		required: []string{"name", "value"},
+	},
+	"strategy": {
+		children: []string{"storage", "indexes", "cache"},
+		must:     []string{"storage"},
+	},
+	"storage": {
+		attrs:    []string{"type", "drive", "database", "table", "router", "route", "validator", "tx"},
+		required: []string{"type", "database", "table"},
+	},
+	"cache": {
+		attrs:    []string{"type", "ttl", "size", "keys"},
+		required: []string{"type"},
+	},
+	"indexes": {
+		children: []string{"index"},
+	},
+	"index": {
+		attrs:    []string{"name", "fields", "unique", "ttl"},
+		required: []string{"fields"},
+	},
+	"relations": {
+		children: []string{"relation"},
+	},
+	"relation": {
+		attrs:    []string{"name", "type", "module", "meta", "foreign"},
+		required: []string{"name", "type", "module", "meta", "foreign"},
+	},
+}
+
+type metaLines struct {
+	meta   int
+	keys   []int
+	fields []int
+}
+
+type validateErrors struct {
+	filename string
+	data     []byte
+	list     []string
+}
+
+func (v *validateErrors) add(offset int64, format string, args ...interface{}) {
+	line := bytes.Count(v.data[:offset], []byte("\n")) + 1
+	v.list = append(v.list, fmt.Sprintf("%s:%d: %s", v.filename, line, fmt.Sprintf(format, args...)))
+}
+
+func (v *validateErrors) addLine(line int, format string, args ...interface{}) {
+	if line <= 0 {
+		v.list = append(v.list, fmt.Sprintf("%s: %s", v.filename, fmt.Sprintf(format, args...)))
+		return
+	}
+	v.list = append(v.list, fmt.Sprintf("%s:%d: %s", v.filename, line, fmt.Sprintf(format, args...)))
+}
+
+func (v *validateErrors) err() error {
+	if len(v.list) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(v.list, "\n"))
+}
+
+// 严格校验meta xml，未知的元素和属性、缺失的必填项、非法的字段名与默认值都会返回带文件行号的错误
+func validateMeta(filename string, data []byte) (meta Meta, err error) {
+	verr := &validateErrors{filename: filename, data: data}
+	lines, err := validateElements(data, verr)
+	if err != nil {
+		return
+	}
+	if err = verr.err(); err != nil {
+		return
+	}
+	if err = xml.Unmarshal(data, &meta); err != nil {
+		return
+	}
+	meta.Key = meta.Keys[0]
+
+	checkMetaName(meta, lines, verr)
+	checkKeys(meta, lines, verr)
+	checkFields(meta, lines, verr)
+	checkEnumNames(meta, lines, verr)
+	return meta, verr.err()
+}
+
+func validateElements(data []byte, verr *validateErrors) (lines metaLines, err error) {
+	type openElement struct {
+		name     string
+		offset   int64
+		children map[string]bool
+	}
+	var stack []*openElement
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		offset := decoder.InputOffset()
+		tok, terr := decoder.Token()
+		if terr == io.EOF {
+			break
+		}
+		if terr != nil {
+			verr.add(offset, "%s", terr.Error())
+			return lines, verr.err()
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			rule, known := elementRules[name]
+			if len(stack) == 0 {
+				if name != "meta" {
+					verr.add(offset, "root element must be <meta>, got <%s>", name)
+				}
+			} else {
+				parent := stack[len(stack)-1]
+				if !inStrings(elementRules[parent.name].children, name) {
+					verr.add(offset, "unknown element <%s> in <%s>", name, parent.name)
+					known = false
+				}
+				parent.children[name] = true
+			}
+
+			if known {
+				attrs := map[string]bool{}
+				for _, attr := range t.Attr {
+					if isNamespaceAttr(attr) {
+						continue
+					}
+					if !inStrings(rule.attrs, attr.Name.Local) {
+						verr.add(offset, "unknown attribute %q on <%s>", attr.Name.Local, name)
+					}
+					attrs[attr.Name.Local] = true
+				}
+				for _, attr := range rule.required {
+					if !attrs[attr] {
+						verr.add(offset, "<%s> missing required attribute %q", name, attr)
+					}
+				}
+				if name == "meta" {
+					lines.meta = bytes.Count(data[:offset], []byte("\n")) + 1
+				}
+				if name == "key" {
+					lines.keys = append(lines.keys, bytes.Count(data[:offset], []byte("\n"))+1)
+				}
+				if name == "field" && len(stack) == 2 {
+					lines.fields = append(lines.fields, bytes.Count(data[:offset], []byte("\n"))+1)
+				}
+			}
+			stack = append(stack, &openElement{name: name, offset: offset, children: map[string]bool{}})
+		case xml.EndElement:
+			current := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, child := range elementRules[current.name].must {
+				if !current.children[child] {
+					verr.add(current.offset, "<%s> missing required element <%s>", current.name, child)
+				}
+			}
+		}
+	}
+	return
+}
+
+func isNamespaceAttr(attr xml.Attr) bool {
+	return attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" || attr.Name.Space == "xsi" ||
+		attr.Name.Space == "http://www.w3.org/2001/XMLSchema-instance"
+}
+
+func checkMetaName(meta Meta, lines metaLines, verr *validateErrors) {
+	funcName := formatUcfirstName(meta.Module) + formatUcfirstName(meta.Name)
+	if !isExportedIdent(funcName) {
+		verr.addLine(lines.meta, "module %q and name %q do not form a valid go identifier", meta.Module, meta.Name)
+	}
+	for i, key := range meta.Keys {
+		if !isExportedIdent(formatUcfirstName(key.Name)) {
+			verr.addLine(lines.line(lines.keys, i), "key name %q is not a valid go identifier", key.Name)
+		}
+	}
+}
+
+// 解析yaml、json时没有行号，返回0
+func (l metaLines) line(list []int, i int) int {
+	if i < len(list) {
+		return list[i]
+	}
+	return 0
+}
+
+func checkFields(meta Meta, lines metaLines, verr *validateErrors) {
+	var version string
+	names := map[string]int{}
+	goNames := map[string]int{}
+	for i, key := range meta.Keys {
+		line := lines.line(lines.keys, i)
+		if prev, ok := names[key.Name]; ok {
+			verr.addLine(line, "duplicate key name %q, first defined at line %d", key.Name, prev)
+		}
+		names[key.Name] = line
+		goNames[formatUcfirstName(key.Name)] = line
+	}
+	for i, field := range meta.Fields.List {
+		line := lines.line(lines.fields, i)
+		if !isExportedIdent(ucfirst(field.Name)) || !isExportedIdent(formatUcfirstName(field.Name)) {
+			verr.addLine(line, "field name %q is not a valid go identifier", field.Name)
+		}
+		if prev, ok := names[field.Name]; ok {
+			verr.addLine(line, "duplicate field name %q, first defined at line %d", field.Name, prev)
+		} else if prev, ok := goNames[ucfirst(field.Name)]; ok {
+			verr.addLine(line, "field name %q conflicts with line %d after ucfirst", field.Name, prev)
+		} else if prev, ok := goNames[formatUcfirstName(field.Name)]; ok {
+			verr.addLine(line, "field name %q conflicts with line %d after ucfirst", field.Name, prev)
+		}
+		if inStrings(reservedMetaNames, ucfirst(field.Name)) || inStrings(reservedMetaNames, formatUcfirstName(field.Name)) {
+			verr.addLine(line, "field name %q conflicts with the generated method %s", field.Name, formatUcfirstName(field.Name))
+		}
+		names[field.Name] = line
+		goNames[ucfirst(field.Name)] = line
+		goNames[formatUcfirstName(field.Name)] = line
+
+		if field.Unit != "" && !isTimeType(field.Type) {
+			verr.addLine(line, "field %q unit is only supported by ctime, mtime and dtime", field.Name)
+		} else if !inStrings(timeUnits, field.Unit) {
+			verr.addLine(line, "field %q unknown unit %q", field.Name, field.Unit)
+		}
+		if field.Version {
+			if field.Type != "int" && field.Type != "int64" {
+				verr.addLine(line, "version field %q must be int or int64", field.Name)
+			}
+			if version != "" {
+				verr.addLine(line, "field %q conflicts with version field %q, only one version field is allowed", field.Name, version)
+			}
+			version = field.Name
+		}
+		if !isKnownType(field) {
+			verr.addLine(line, "field %q unknown type %q, supported types: %s", field.Name, field.Type, knownTypeNames())
+		} else if isObjectIDType(field.Type) && meta.Strategy.Storage.Type != "mongodb" {
+			verr.addLine(line, "field %q type objectid is only supported by mongodb storage", field.Name)
+		}
+		checkChildFields(field, line, verr)
+		checkEnumField(field, line, verr)
+		checkRules(field, meta.Strategy.Storage.Type == "mongodb", line, verr)
+		if field.Generate != "" {
+			verr.addLine(line, "field %q generate is only supported by key", field.Name)
+		}
+		if softDelete, ok := getSoftDeleteField(meta); ok && softDelete.Name == field.Name && field.Default != "" {
+			// 有默认值的记录一插入就处于已删除状态
+			verr.addLine(line, "soft delete field %q can not have a default", field.Name)
+		} else if field.Type == "json" && field.Default != "" && meta.Strategy.Storage.Type == "mongodb" {
+			verr.addLine(line, "field %q json default is not supported by mongodb", field.Name)
+		} else if err := checkDefault(field); err != nil {
+			verr.addLine(line, "field %q default %q: %s", field.Name, field.Default, err.Error())
+		}
+	}
+}
+
+// yaml和json格式没有元素级的规则校验，这里补充必填项检查
+func checkRequired(meta Meta, verr *validateErrors) {
+	required := [][2]string{
+		{"module", meta.Module},
+		{"name", meta.Name},
+		{"strategy.storage.type", meta.Strategy.Storage.Type},
+		{"strategy.storage.database", meta.Strategy.Storage.Database},
+		{"strategy.storage.table", meta.Strategy.Storage.Table},
+	}
+	if len(meta.Keys) == 0 {
+		required = append(required, [2]string{"key", ""})
+	}
+	for i, key := range meta.Keys {
+		required = append(required, [2]string{fmt.Sprintf("key[%d].name", i), key.Name})
+		required = append(required, [2]string{fmt.Sprintf("key[%d].type", i), key.Type})
+	}
+	for i, field := range meta.Fields.List {
+		required = append(required, [2]string{fmt.Sprintf("fields[%d].name", i), field.Name})
+		required = append(required, [2]string{fmt.Sprintf("fields[%d].type", i), field.Type})
+		for j, v := range field.Values {
+			required = append(required, [2]string{fmt.Sprintf("fields[%d].values[%d].name", i, j), v.Name})
+			required = append(required, [2]string{fmt.Sprintf("fields[%d].values[%d].value", i, j), v.Value})
+		}
+	}
+	for i, index := range meta.Strategy.Indexes.List {
+		required = append(required, [2]string{fmt.Sprintf("strategy.indexes[%d].fields", i), index.Fields})
+	}
+	if meta.Strategy.Cache != nil {
+		required = append(required, [2]string{"strategy.cache.type", meta.Strategy.Cache.Type})
+	}
+
+	for i, relation := range meta.Relations.List {
+		for _, attr := range [][2]string{{"name", relation.Name}, {"type", relation.Type}, {"module", relation.Module}, {"meta", relation.Meta}, {"foreign", relation.Foreign}} {
+			required = append(required, [2]string{fmt.Sprintf("relations[%d].%s", i, attr[0]), attr[1]})
+		}
+	}
+
+	for _, v := range required {
+		if v[1] == "" {
+			verr.addLine(0, "missing required %q", v[0])
+		}
+	}
+}
+
+func isExportedIdent(name string) bool {
+	for _, v := range name {
+		return unicode.IsUpper(v) && token.IsIdentifier(name)
+	}
+	return false
+}
+
+func inStrings(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
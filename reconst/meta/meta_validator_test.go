@@ -0,0 +1,45 @@
+package meta
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateMetaStrict(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		err  string
+	}{
+		{"unknown attribute", strings.Replace(testUserXML, `<field name="age" type="int"`, `<field name="age" typ="int"`, 1),
+			`user.xml:6: unknown attribute "typ" on <field>`},
+		{"unknown element", strings.Replace(testUserXML, `<fields>`, `<fields><column name="x"/>`, 1),
+			"unknown element <column> in <fields>"},
+		{"missing attribute", strings.Replace(testUserXML, ` table="user"`, ``, 1),
+			`<storage> missing required attribute "table"`},
+		{"duplicate field", strings.Replace(testUserXML, `<field name="email"`, `<field name="age"`, 1),
+			`user.xml:6: duplicate field name "age", first defined at line 5`},
+		{"invalid identifier", strings.Replace(testUserXML, `<field name="email"`, `<field name="e-mail"`, 1),
+			`field name "e-mail" is not a valid go identifier`},
+		{"second version", strings.Replace(testUserXML, `<field name="age" type="int"`, `<field name="age" type="int" version="true"`, 1),
+			`field "version" conflicts with version field "age"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeMeta("user.xml", []byte(tt.src))
+			assertError(t, err, tt.err)
+		})
+	}
+
+	if _, err := decodeMeta("user.xml", []byte(testUserXML)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateMetaReportsAllErrors(t *testing.T) {
+	src := strings.Replace(testUserXML, `type="int" min="0"`, `type="integer" min="0"`, 1)
+	src = strings.Replace(src, `unit="millisecond"`, `unit="minute"`, 1)
+	_, err := decodeMeta("user.xml", []byte(src))
+	assertError(t, err, `user.xml:6: field "age" unknown type "integer"`)
+	assertError(t, err, `user.xml:15: field "mtime" unknown unit "minute"`)
+}
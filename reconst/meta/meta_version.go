@@ -0,0 +1,126 @@
+package meta
+
+import (
+	"fmt"
+)
+
+// 标记了version的字段作为乐观锁的版本号
+func getVersionField(meta Meta) (MetaField, bool) {
+	for _, field := range meta.Fields.List {
+		if field.Version {
+			return field, true
+		}
+	}
+	return MetaField{}, false
+}
+
+// 已存在的记录按主键和版本号更新全部字段，并将版本号加1
+func genSaveVersionCode(meta Meta, funcName string) string {
+	version, ok := getVersionField(meta)
+	if !ok {
+		return ""
+	}
+
+	// ctime只在插入时写入，按版本号更新时不修改
+	var sets string
+	ctime, _ := getSpTTime(meta.Fields, "ctime")
+	for _, field := range meta.Fields.List {
+		if field.Name != version.Name && field.Name != ctime.Name {
+			sets += fmt.Sprintf("\t\t\"%s\": {meta.%s},\n", field.Name, ucfirst(field.Name))
+		}
+	}
+	sets += fmt.Sprintf("\t\t\"%s\": {meta.%s + 1},\n", version.Name, ucfirst(version.Name))
+
+	return fmt.Sprintf(`
+// versionSets 按版本号更新记录时写入的字段，版本号加1
+func (meta *Meta%s)versionSets() map[string][]interface{} {
+	return map[string][]interface{}{
+%s	}
+}
+
+// saveVersion 版本号不一致时说明记录已被修改，返回ErrStaleObject
+func (q *query%s)saveVersion(meta *Meta%s) error {
+	query := q.query
+	query.Conditions = []play.Condition{
+		{AndOr:true, Field:"%s", Con:"Equal", Val:meta.%s},
+		{AndOr:true, Field:"%s", Con:"Equal", Val:meta.%s},
+	}
+	query.Sets = meta.versionSets()
+	n, err := %s.Update(&query)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrStaleObject
+	}
+	meta.%s++
+	return nil
+}
+`, funcName, sets, funcName, funcName, meta.Key.Name, formatUcfirstName(meta.Key.Name), version.Name, ucfirst(version.Name),
+		meta.Strategy.Storage.Drive, ucfirst(version.Name))
+}
+
+// 带版本号的upsert：先按conflict字段和版本号更新，没有更新到记录时，记录不存在则插入，否则返回ErrStaleObject
+func genUpsertVersionCode(meta Meta, funcName string, insert string) string {
+	version, _ := getVersionField(meta)
+	drive := meta.Strategy.Storage.Drive
+	return fmt.Sprintf(`query := q.query
+	query.Conditions = []play.Condition{{AndOr:true, Field:"%s", Con:"Equal", Val:meta.%s}}
+	for _, field := range conflict {
+		query.Conditions = append(query.Conditions, play.Condition{AndOr:true, Field:string(field), Con:"Equal", Val:meta.fieldValue(field)})
+	}
+	query.Sets = meta.versionSets()
+	n, err := %s.Update(&query)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		meta.%s++
+		return nil
+	}
+	query.Conditions = query.Conditions[1:]
+	if n, err = %s.Count(&query); err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrStaleObject
+	}
+	%s`, version.Name, ucfirst(version.Name), drive, ucfirst(version.Name), drive, insert)
+}
+
+// 带版本号的updateMany逐条按主键和版本号更新，遇到已被修改的记录时停止并返回ErrStaleObject
+func genUpdateManyVersionCode(meta Meta) string {
+	return `var n int64
+	for _, meta := range list {
+		if err := q.saveVersion(meta); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil`
+}
+
+// Update的执行部分，带版本号条件时自动递增版本号，没有更新到记录则返回ErrStaleObject
+func genUpdateExecCode(meta Meta) string {
+	drive := meta.Strategy.Storage.Drive
+	version, ok := getVersionField(meta)
+	if !ok {
+		return fmt.Sprintf("return %s.Update(query)", drive)
+	}
+
+	return fmt.Sprintf(`versioned := false
+	if _, ok := query.Sets["%s"]; !ok {
+		query.Sets["%s"] = []interface{}{1, "+"}
+		for _, c := range q.query.Conditions {
+			if v, ok := c.Val.(%s); ok && c.Field == "%s" && c.Con == "Equal" {
+				query.Sets["%s"] = []interface{}{v + 1}
+				versioned = true
+			}
+		}
+	}
+	n, err := %s.Update(query)
+	if err == nil && n == 0 && versioned {
+		return 0, ErrStaleObject
+	}
+	return n, err`, version.Name, version.Name, getFieldGolangType(version), version.Name, version.Name, drive)
+}
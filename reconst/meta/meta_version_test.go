@@ -0,0 +1,72 @@
+package meta
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOptimisticLocking(t *testing.T) {
+	sources := mustGenerate(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML})
+	assertDecls(t, sources, "common.go", "ErrStaleObject")
+	assertDecls(t, sources, "shop_user.go", "MetaShopUser.versionSets", "queryShopUser.saveVersion")
+	assertNoDecls(t, sources, "shop_order.go", "queryShopOrder.saveVersion")
+
+	update := funcSource(t, sources, "shop_user.go", "queryShopUser.Update")
+	for _, want := range []string{`query.Sets["version"] = []interface{}{v + 1}`, "return 0, ErrStaleObject"} {
+		if !strings.Contains(update, want) {
+			t.Errorf("Update does not contain %s:\n%s", want, update)
+		}
+	}
+	upsert := funcSource(t, sources, "shop_user.go", "queryShopUser.upsert")
+	if !strings.Contains(upsert, `{AndOr: true, Field: "version", Con: "Equal", Val: meta.Version}`) {
+		t.Errorf("upsert should check the version:\n%s", upsert)
+	}
+}
+
+func TestVersionFieldType(t *testing.T) {
+	src := strings.Replace(testUserXML, `<field name="version" type="int" version="true"/>`, `<field name="version" type="string" version="true"/>`, 1)
+	_, err := decodeMeta("user.xml", []byte(src))
+	assertError(t, err, `version field "version" must be int or int64`)
+}
+
+// 并发修改同一条记录时，后保存的一方得到ErrStaleObject，Update按版本号条件更新
+func TestOptimisticLockingRun(t *testing.T) {
+	buildProject(t, map[string]string{"user.xml": testUserXML, "order.xml": testOrderXML}, false, map[string]string{"version_test.go": `package db
+
+import "testing"
+
+func TestVersion(t *testing.T) {
+	defer UseShopUserStore(NewShopUserMemoryStore())()
+	user := &MetaShopUser{Name: "bob", Status: ShopUserStatusActive}
+	if err := ShopUser().Save(user); err != nil {
+		t.Fatal(err)
+	}
+	a, err := ShopUser().WhereIdEqual(user.Id).GetOne()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := *a
+	a.Age = 1
+	if err := ShopUser().Save(a); err != nil || a.Version != 1 {
+		t.Fatalf("Save() = %v, version %d, want 1", err, a.Version)
+	}
+	b.Age = 2
+	if err := ShopUser().Save(&b); err != ErrStaleObject {
+		t.Fatalf("saving a stale copy = %v, want ErrStaleObject", err)
+	}
+
+	if _, err := ShopUser().WhereIdEqual(user.Id).WhereVersionEqual(0).SetAge(3).Update(); err != ErrStaleObject {
+		t.Errorf("Update with a stale version = %v, want ErrStaleObject", err)
+	}
+	if n, err := ShopUser().WhereIdEqual(user.Id).WhereVersionEqual(1).SetAge(3).Update(); n != 1 || err != nil {
+		t.Errorf("Update with the current version = %d, %v", n, err)
+	}
+	if _, err := ShopUser().WhereIdEqual(user.Id).SetAge(4).Update(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ShopUser().WhereIdEqual(user.Id).GetOne(); err != nil || got.Version != 3 || got.Age != 4 {
+		t.Errorf("GetOne() = %+v, %v, want version 3 age 4", got, err)
+	}
+}
+`})
+}
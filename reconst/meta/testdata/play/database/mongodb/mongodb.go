@@ -0,0 +1,78 @@
+package mongodb
+
+import (
+	"errors"
+
+	"github.com/leochen2038/play"
+)
+
+// Calls 按顺序记录调用过的驱动函数
+var Calls []string
+
+// operators 驱动支持的查询条件，查询中出现其他条件时与驱动一样返回错误
+var operators = map[string]string{
+	"Equal":          "$eq",
+	"NotEqual":       "$ne",
+	"Less":           "$lt",
+	"Greater":        "$gt",
+	"Like":           "$regex",
+	"Between":        "$gte",
+	"In":             "$in",
+	"NotIn":          "$nin",
+	"LessOrEqual":    "$lte", // next
+	"GreaterOrEqual": "$gte", // next
+	"NotLike":        "$not", // next
+	"NotBetween":     "$not", // next
+	"IsNull":         "$eq",  // next
+	"IsNotNull":      "$ne",  // next
+	"Group":          "$and", // next
+}
+
+func checkConditions(conditions []play.Condition) error {
+	for _, c := range conditions {
+		if _, ok := operators[c.Con]; !ok {
+			return errors.New("mongodb: unsupported condition " + c.Con)
+		}
+		if sub, ok := c.Val.([]play.Condition); ok {
+			if err := checkConditions(sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func GetOne(meta interface{}, query *play.Query) error {
+	Calls = append(Calls, "GetOne")
+	return checkConditions(query.Conditions)
+}
+
+func GetList(dest interface{}, query *play.Query) error {
+	Calls = append(Calls, "GetList")
+	return checkConditions(query.Conditions)
+}
+
+func Count(query *play.Query) (int64, error) {
+	Calls = append(Calls, "Count")
+	return 0, checkConditions(query.Conditions)
+}
+
+func Update(query *play.Query) (int64, error) {
+	Calls = append(Calls, "Update")
+	return 0, checkConditions(query.Conditions)
+}
+
+func Delete(query *play.Query) (int64, error) {
+	Calls = append(Calls, "Delete")
+	return 0, checkConditions(query.Conditions)
+}
+
+func Save(meta interface{}, id interface{}, query *play.Query) error {
+	Calls = append(Calls, "Save")
+	return nil
+}
+
+func UpdateAndGetOne(meta interface{}, query *play.Query) error {
+	Calls = append(Calls, "UpdateAndGetOne")
+	return checkConditions(query.Conditions)
+}
@@ -0,0 +1,30 @@
+package mongodb
+
+import (
+	"github.com/leochen2038/play"
+)
+
+func SaveMany(list interface{}, query *play.Query) error {
+	Calls = append(Calls, "SaveMany")
+	return nil
+}
+
+func Upsert(meta interface{}, filter interface{}, insertOnly []string, query *play.Query) error {
+	Calls = append(Calls, "Upsert")
+	return nil
+}
+
+func UpdateMany(list interface{}, query *play.Query) (int64, error) {
+	Calls = append(Calls, "UpdateMany")
+	return 0, nil
+}
+
+func Aggregate(dest interface{}, fn string, field string, query *play.Query) error {
+	Calls = append(Calls, "Aggregate")
+	return nil
+}
+
+func GroupCount(dest interface{}, field string, query *play.Query) error {
+	Calls = append(Calls, "GroupCount")
+	return nil
+}
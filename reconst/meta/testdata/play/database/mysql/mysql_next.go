@@ -0,0 +1,38 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/leochen2038/play"
+)
+
+func Begin(database string) (*sql.Tx, error) {
+	Calls = append(Calls, "Begin")
+	return nil, errors.New("no database")
+}
+
+func SaveMany(list interface{}, query *play.Query) ([]int64, error) {
+	Calls = append(Calls, "SaveMany")
+	return nil, nil
+}
+
+func Upsert(meta interface{}, conflict []string, insertOnly []string, query *play.Query) (int64, error) {
+	Calls = append(Calls, "Upsert")
+	return 0, nil
+}
+
+func UpdateMany(list interface{}, query *play.Query) (int64, error) {
+	Calls = append(Calls, "UpdateMany")
+	return 0, nil
+}
+
+func Aggregate(dest interface{}, fn string, field string, query *play.Query) error {
+	Calls = append(Calls, "Aggregate")
+	return nil
+}
+
+func GroupCount(dest interface{}, field string, query *play.Query) error {
+	Calls = append(Calls, "GroupCount")
+	return nil
+}
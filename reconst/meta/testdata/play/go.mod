@@ -0,0 +1,3 @@
+module github.com/leochen2038/play
+
+go 1.14
@@ -0,0 +1,47 @@
+// Package play 测试用的框架桩，提供生成代码用到的play v0.4.5接口，
+// 以"// next"结尾的行和*_next.go文件是v0.4.5之后加入的接口，对照已发布版本编译时去掉
+package play
+
+type Condition struct {
+	AndOr bool
+	Field string
+	Con   string
+	Val   interface{}
+}
+
+type Query struct {
+	Module     string
+	Name       string
+	DBName     string
+	Table      string
+	Router     string
+	Fields     map[string]bool
+	Sets       map[string][]interface{}
+	Conditions []Condition
+	Order      [][2]string
+	Group      []string
+	Limit      [2]int64
+	Tx         interface{} // next
+}
+
+// ErrorCode 带错误码的错误，Render按Code和Info输出
+type ErrorCode struct {
+	code int
+	info string
+}
+
+func NewErrorCode(code int, info string) *ErrorCode {
+	return &ErrorCode{code: code, info: info}
+}
+
+func (e *ErrorCode) Error() string {
+	return e.info
+}
+
+func (e *ErrorCode) Code() int {
+	return e.code
+}
+
+func (e *ErrorCode) Info() string {
+	return e.info
+}
@@ -5,12 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"github.com/leochen2038/goplay/reconst/action"
+	"github.com/leochen2038/goplay/reconst/env"
 	"github.com/leochen2038/goplay/reconst/meta"
 	"os"
+	"os/exec"
+	"runtime"
 	"strings"
 )
 
 func ReconstProject() (err error) {
+	loadFrameworkAPIs(env.ProjectPath)
 	if err = meta.MetaGenerator(); err != nil {
 		return
 	}
@@ -33,3 +37,21 @@ func parseModuleName(path string) (string, error) {
 
 	return strings.Split(string(data), " ")[1], nil
 }
+
+// 按项目实际依赖的框架源码确定生成代码可以使用的接口，无法定位框架源码(例如还未下载依赖)时
+// 只使用v0.4.5的接口，依赖新接口的方法不生成
+func loadFrameworkAPIs(path string) {
+	cmd := exec.Command(runtime.GOROOT()+"/bin/go", "list", "-m", "-f", "{{.Dir}}", env.FrameworkName)
+	cmd.Dir = path
+	out, err := cmd.Output()
+	dir := strings.TrimSpace(string(out))
+	if err != nil || dir == "" {
+		fmt.Println("warning: can not locate", env.FrameworkName, "source, generating meta code for", env.FrameworkName, "v0.4.5")
+		meta.FrameworkAPIs = map[string]bool{}
+		return
+	}
+	if missing := meta.LoadFrameworkAPIs(dir); len(missing) > 0 {
+		fmt.Println("warning:", env.FrameworkName, "in", dir, "does not provide", strings.Join(missing, ", "),
+			"meta methods using them are not generated")
+	}
+}